@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xacnio/backupper/pkg/crypt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Decrypt decrypts .age/.gpg files produced by the encryption stage.
+func Decrypt(args []string) error {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	identity := flags.String("identity", "", "age identity file or gpg secret key file")
+	passphrase := flags.String("passphrase", "", "passphrase of the gpg secret key")
+	output := flags.String("to", "", "output folder (default: folder of each file)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backupper decrypt --identity <key file> [--passphrase <pass>] [--to <dir>] <file>...")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *identity == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing identity or files")
+	}
+
+	if *output != "" {
+		err := os.MkdirAll(*output, 0777)
+		if err != nil {
+			return err
+		}
+	}
+
+	decrypters := make(map[string]*crypt.Decrypter)
+	for _, file := range flags.Args() {
+		format := strings.TrimPrefix(filepath.Ext(file), ".")
+		if !crypt.IsSupported(format) {
+			return fmt.Errorf("%s: unknown encryption format", file)
+		}
+		decrypter, ok := decrypters[format]
+		if !ok {
+			var err error
+			decrypter, err = crypt.NewDecrypter(format, *identity, *passphrase)
+			if err != nil {
+				return err
+			}
+			decrypters[format] = decrypter
+		}
+
+		dst := strings.TrimSuffix(file, crypt.Extension(format))
+		if *output != "" {
+			dst = filepath.Join(*output, filepath.Base(dst))
+		}
+		err := decrypter.DecryptFile(file, dst)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		fmt.Println(dst)
+	}
+	return nil
+}
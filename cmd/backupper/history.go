@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// History prints the recorded runs of a backup.
+func History(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	job := flags.String("job", "", "name of the backup (default: all backups)")
+	limit := flags.Int("limit", 20, "number of runs to print, 0 prints all")
+	asJSON := flags.Bool("json", false, "print as JSON, with the stage, source and destination results")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backupper history [--job <name>] [--limit <n>] [--json]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	setup()
+	runs, err := history.List(*job, *limit)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if runs == nil {
+			runs = []history.Run{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(runs)
+	}
+
+	if len(runs) == 0 {
+		fmt.Println("No runs")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tJOB\tKIND\tDURATION\tSTATUS\tFILES\tSIZE\tDELETED\tERROR")
+	for _, run := range runs {
+		status := "success"
+		if !run.Success {
+			status = "failed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s\n",
+			run.StartedAt.In(utils.TimeLocation).Format("2006-01-02 15:04:05"),
+			run.Job,
+			run.Kind,
+			run.Duration().Round(time.Millisecond),
+			status,
+			run.Files,
+			utils.FormatSize(run.Bytes),
+			run.Deleted,
+			run.Error,
+		)
+	}
+	return w.Flush()
+}
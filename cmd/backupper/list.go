@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// List prints the stored runs of a backup on its destinations.
+func List(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	job := flags.String("job", "", "name of the backup")
+	destination := flags.String("destination", "", "name or type of the destination (default: all destinations)")
+	asJSON := flags.Bool("json", false, "print as JSON")
+	showFiles := flags.Bool("files", false, "print the files of each run")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backupper list --job <name> [--destination <name>] [--json] [--files]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *job == "" {
+		flags.Usage()
+		return errors.New("missing job")
+	}
+
+	setup()
+	b, err := findBackup(*job)
+	if err != nil {
+		return err
+	}
+
+	lists, err := b.ListSnapshots(*destination)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(lists)
+	}
+
+	for i, list := range lists {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Destination: %s (%s)\n", list.Destination, list.Type)
+		if list.Error != "" {
+			fmt.Println("  Error: " + list.Error)
+			continue
+		}
+		if len(list.Snapshots) == 0 {
+			fmt.Println("  No backups")
+			continue
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  DATE\tTIME\tFILES\tSIZE\tPRUNE")
+		for _, snapshot := range list.Snapshots {
+			prune := "-"
+			if snapshot.PruneReason != "" {
+				prune = "yes (" + snapshot.PruneReason + ")"
+			} else if len(snapshot.KeepReasons) > 0 {
+				prune = "no (" + strings.Join(snapshot.KeepReasons, ", ") + ")"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%s\t%s\n", snapshot.Date, snapshot.Time.Format("2006-01-02 15:04:05 -07:00"), len(snapshot.Files), utils.FormatSize(snapshot.Size), prune)
+			if *showFiles {
+				for _, file := range snapshot.Files {
+					fmt.Fprintf(w, "    %s\t\t\t%s\t\n", file.Name, utils.FormatSize(file.Size))
+				}
+			}
+		}
+		w.Flush()
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/go-co-op/gocron"
 	"github.com/xacnio/backupper/internal/backup"
 	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/metrics"
+	"github.com/xacnio/backupper/internal/server"
 	"github.com/xacnio/backupper/internal/utils"
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"os"
@@ -17,31 +19,83 @@ import (
 const VERSION = "0.0.9"
 
 func main() {
-	// Load config and logger
-	config.ReadConfig()
-	logger.Init()
-
-	// Load timezone
-	if config.Get().Timezone != nil {
-		utils.LoadLocation(*config.Get().Timezone)
-	} else {
-		utils.LoadLocation(os.Getenv("TZ"))
+	// Sub commands
+	if len(os.Args) > 1 {
+		logger.Console = "stderr"
+		var err error
+		switch os.Args[1] {
+		case "decrypt":
+			err = Decrypt(os.Args[2:])
+		case "restore":
+			err = Restore(os.Args[2:])
+		case "list":
+			err = List(os.Args[2:])
+		case "prune":
+			err = Prune(os.Args[2:])
+		case "history":
+			err = History(os.Args[2:])
+		default:
+			fmt.Fprintln(os.Stderr, "Unknown command: "+os.Args[1])
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
+	setup()
+
 	// Create scheduler and load all the backups
 	s := gocron.NewScheduler(utils.TimeLocation)
 	backups := utils.ConvertToStruct[[]backup.Backup](config.Get().Backups)
 	for i := range backups {
 		bup := &backups[i]
 		var err error
-		if strings.Count(bup.CronExpression, " ") == 5 {
-			backups[i].Job, err = s.CronWithSeconds(bup.CronExpression).Do(bup.CreateFunc())
-		} else {
-			backups[i].Job, err = s.Cron(bup.CronExpression).Do(bup.CreateFunc())
-		}
+		backups[i].Job, err = schedule(s, bup.CronExpression, bup.CreateFunc())
 		if err != nil {
 			logger.Main.Errorw("cron error", "name", bup.Name, "error", err)
 		}
+		if bup.PruneCronExpression != "" {
+			_, err = schedule(s, bup.PruneCronExpression, bup.CreatePruneFunc())
+			if err != nil {
+				logger.Main.Errorw("prune cron error", "name", bup.Name, "error", err)
+			}
+		}
+		for _, n := range bup.Notifications {
+			scheduleDigest(s, n, []string{bup.Name})
+		}
+	}
+
+	// Digests of the global notifications cover every backup
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	for _, n := range backup.GlobalNotifications() {
+		scheduleDigest(s, n, names)
+	}
+
+	// Start the metrics endpoint, the jobs API and the dashboard
+	if config.Get().HTTPListen != nil && *config.Get().HTTPListen != "" {
+		var jobs []*backup.Backup
+		for i := range backups {
+			jobs = append(jobs, &backups[i])
+		}
+		err := metrics.Init(names)
+		if err != nil {
+			logger.Main.Errorw("metrics error", "error", err)
+		}
+		opts := server.Options{
+			Listen:    *config.Get().HTTPListen,
+			Dashboard: config.Get().Dashboard,
+			Backups:   jobs,
+		}
+		if config.Get().APIToken != nil {
+			opts.Token = *config.Get().APIToken
+		}
+		server.Start(opts)
 	}
 
 	// Print start message
@@ -55,6 +109,48 @@ func main() {
 	s.StartBlocking()
 }
 
+// schedule adds a job to the scheduler, expressions with 6 fields have seconds.
+func schedule(s *gocron.Scheduler, cronExpression string, jobFun interface{}) (*gocron.Job, error) {
+	if strings.Count(cronExpression, " ") == 5 {
+		return s.CronWithSeconds(cronExpression).Do(jobFun)
+	}
+	return s.Cron(cronExpression).Do(jobFun)
+}
+
+// scheduleDigest schedules the digest of a notification with "digestCronExpr".
+func scheduleDigest(s *gocron.Scheduler, n backup.NotificationInfo, jobs []string) {
+	if n.DigestCronExpression == "" {
+		return
+	}
+	_, err := schedule(s, n.DigestCronExpression, backup.CreateDigestFunc(n, jobs))
+	if err != nil {
+		logger.Main.Errorw("digest cron error", "notification", n.Name, "error", err)
+	}
+}
+
+// setup loads the config, the loggers and the timezone.
+func setup() {
+	config.ReadConfig()
+	logger.Init()
+
+	if config.Get().Timezone != nil {
+		utils.LoadLocation(*config.Get().Timezone)
+	} else {
+		utils.LoadLocation(os.Getenv("TZ"))
+	}
+}
+
+// findBackup returns the backup of the config with the given name.
+func findBackup(name string) (*backup.Backup, error) {
+	backups := utils.ConvertToStruct[[]backup.Backup](config.Get().Backups)
+	for i := range backups {
+		if backups[i].Name == name {
+			return &backups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("backup not found: %q", name)
+}
+
 func PrintStartMessage(version string, backups *[]backup.Backup) {
 	fmt.Println("Backupper v" + version)
 	fmt.Println("Total schedules: " + fmt.Sprintf("%d", len(*backups)))
@@ -91,8 +187,8 @@ func DetectSignal(sigc chan os.Signal, backups *[]backup.Backup) {
 	waiting := false
 	for {
 		if !waiting {
-			for _, b := range *backups {
-				if b.Job.IsRunning() {
+			for i := range *backups {
+				if (*backups)[i].IsRunning() {
 					fmt.Println("Waiting for backup to finish to exit...")
 					waiting = true
 				}
@@ -102,8 +198,8 @@ func DetectSignal(sigc chan os.Signal, backups *[]backup.Backup) {
 			os.Exit(0)
 		} else {
 			allFinished := true
-			for _, b := range *backups {
-				if b.Job.IsRunning() {
+			for i := range *backups {
+				if (*backups)[i].IsRunning() {
 					allFinished = false
 					break
 				}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/utils"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Prune applies the retention rules of a backup without uploading anything.
+func Prune(args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	job := flags.String("job", "", "name of the backup")
+	destination := flags.String("destination", "", "name or type of the destination (default: all destinations)")
+	dryRun := flags.Bool("dry-run", false, "only print what would be deleted")
+	asJSON := flags.Bool("json", false, "print as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backupper prune --job <name> [--destination <name>] [--dry-run] [--json]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *job == "" {
+		flags.Usage()
+		return errors.New("missing job")
+	}
+
+	setup()
+	b, err := findBackup(*job)
+	if err != nil {
+		return err
+	}
+
+	lists, err := b.Prune(*destination, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(lists)
+	}
+
+	action := "deleted"
+	if *dryRun {
+		action = "would be deleted"
+	}
+	failed := false
+	for i, list := range lists {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Destination: %s (%s)\n", list.Destination, list.Type)
+		if list.Error != "" {
+			failed = true
+			fmt.Println("  Error: " + list.Error)
+		}
+		if len(list.Snapshots) == 0 {
+			fmt.Println("  Nothing to prune")
+			continue
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  DATE\tFILES\tSIZE\tACTION\tREASON")
+		var count int
+		var size int64
+		for _, snapshot := range list.Snapshots {
+			if snapshot.PruneReason != "" {
+				count++
+				size += snapshot.Size
+				fmt.Fprintf(w, "  %s\t%d\t%s\t%s\t%s\n", snapshot.Date, len(snapshot.Files), utils.FormatSize(snapshot.Size), action, pruneReason(snapshot.PruneReason))
+			} else {
+				reason := strings.Join(snapshot.KeepReasons, ", ")
+				if snapshot.PruneSkipped != "" {
+					reason += " (" + pruneReason(snapshot.PruneSkipped) + ")"
+				}
+				fmt.Fprintf(w, "  %s\t%d\t%s\tkept\t%s\n", snapshot.Date, len(snapshot.Files), utils.FormatSize(snapshot.Size), reason)
+			}
+		}
+		w.Flush()
+		fmt.Printf("  %d of %d backups %s (%s)\n", count, len(list.Snapshots), action, utils.FormatSize(size))
+	}
+	if failed {
+		return errors.New("prune failed on some destinations")
+	}
+	return nil
+}
+
+func pruneReason(reason string) string {
+	switch reason {
+	case backup.PruneByGFS:
+		return "not kept by any keep* rule"
+	case backup.PruneByCount:
+		return "over limitByCount"
+	case backup.PruneBySize:
+		return "over limitBySize"
+	case backup.PruneByDate:
+		return "older than limitByDate"
+	}
+	return reason
+}
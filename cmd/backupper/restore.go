@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xacnio/backupper/internal/backup"
+	"os"
+)
+
+// Restore downloads a stored backup run back from one of its destinations.
+func Restore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	job := flags.String("job", "", "name of the backup")
+	at := flags.String("at", "latest", "run to restore: latest, its date suffix or a time")
+	to := flags.String("to", "", "output folder")
+	destination := flags.String("destination", "", "name or type of the destination (default: first destination)")
+	identity := flags.String("identity", "", "age identity file or gpg secret key file for encrypted backups")
+	passphrase := flags.String("passphrase", "", "passphrase of the gpg secret key")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: backupper restore --job <name> [--at <time|latest>] --to <dir> [--destination <name>] [--identity <key file>]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *job == "" || *to == "" {
+		flags.Usage()
+		return errors.New("missing job or output folder")
+	}
+
+	setup()
+	b, err := findBackup(*job)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(*to, 0777)
+	if err != nil {
+		return err
+	}
+	snapshot, err := b.Restore(backup.RestoreOptions{
+		Destination: *destination,
+		At:          *at,
+		To:          *to,
+		Identity:    *identity,
+		Passphrase:  *passphrase,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s (%s, %d files) to %s\n", b.Name, snapshot.Date, len(snapshot.Files), *to)
+	return nil
+}
@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/archive"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type ArchiveInfo struct {
+	Format string `json:"format"`
+	Name   string `json:"name"`
+}
+
+type archiveNameData struct {
+	Name string
+	ID   string
+	Date string
+	Time time.Time
+}
+
+// archiveMatchData renders the archive name of a stored run for retention. The
+// exact time of a run is unknown, a template with .Time doesn't render with it.
+type archiveMatchData struct {
+	Name string
+	ID   string
+	Date string
+}
+
+// archiveName renders the name template of the archive and appends the format
+// extension unless the template already ends with it.
+func (b *Backup) archiveName(info ArchiveInfo) (string, error) {
+	return renderArchiveName(info, archiveNameData{
+		Name: b.Name,
+		ID:   b.stringID(),
+		Date: b.getFileTimeFormat(),
+		Time: b.StartedAt.In(utils.TimeLocation),
+	})
+}
+
+func renderArchiveName(info ArchiveInfo, data interface{}) (string, error) {
+	nameTemplate := info.Name
+	if nameTemplate == "" {
+		nameTemplate = "{{.Name}}"
+	}
+	tmpl, err := template.New("archive").Parse(nameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var bf bytes.Buffer
+	err = tmpl.Execute(&bf, data)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(bf.String()))
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid archive name: %q", name)
+	}
+	if !strings.HasSuffix(name, archive.Extension(info.Format)) {
+		name += archive.Extension(info.Format)
+	}
+	return name, nil
+}
+
+// runArchive packs everything in ./tmp/{id}/ into a single archive which then
+// replaces the contents of the folder.
+func (b *Backup) runArchive() error {
+	info := *b.Archive
+	if info.Format == "" {
+		info.Format = archive.FormatTarGz
+	}
+	if !archive.IsSupported(info.Format) {
+		return fmt.Errorf("unsupported archive format: %q", info.Format)
+	}
+
+	name, err := b.archiveName(info)
+	if err != nil {
+		return err
+	}
+
+	tmpDir := b.tmpDir()
+	archivePath := strings.TrimSuffix(tmpDir, "/") + archive.Extension(info.Format)
+	logger.Main.Debugw("archive start", "name", b.Name, "id", b.ID, "format", info.Format, "file", name)
+	err = archive.Create(info.Format, tmpDir, archivePath)
+	if err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+
+	err = os.RemoveAll(tmpDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(tmpDir, 0777)
+	if err != nil {
+		return err
+	}
+	return os.Rename(archivePath, tmpDir+name)
+}
@@ -3,28 +3,40 @@ package backup
 import (
 	"github.com/go-co-op/gocron"
 	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils"
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 type Backup struct {
-	ID             int64           `json:"-"`
-	Name           string          `json:"name"`
-	Source         SourceInfo      `json:"source"`
-	Destination    DestinationInfo `json:"destination"`
-	CronExpression string          `json:"cronExpr"`
-	StartedAt      time.Time       `json:"-"`
-	CallbackURL    string          `json:"callbackUrl"`
-	DeleteLocal    *bool           `json:"deleteLocal"`
-	Job            *gocron.Job     `json:"-"`
+	ID                  int64              `json:"-"`
+	Name                string             `json:"name"`
+	Source              SourceInfo         `json:"source"`
+	Sources             []SourceInfo       `json:"sources"`
+	Destination         DestinationInfo    `json:"destination"`
+	Destinations        []DestinationInfo  `json:"destinations"`
+	Archive             *ArchiveInfo       `json:"archive"`
+	Encryption          *EncryptionInfo    `json:"encryption"`
+	Manifest            *bool              `json:"manifest"`
+	DestinationQuorum   *int               `json:"destinationQuorum"`
+	CronExpression      string             `json:"cronExpr"`
+	PruneCronExpression string             `json:"pruneCronExpr"`
+	StartedAt           time.Time          `json:"-"`
+	CallbackURL         string             `json:"callbackUrl"`
+	Callback            *CallbackInfo      `json:"callback"`
+	Notifications       []NotificationInfo `json:"notifications"`
+	DeleteLocal         *bool              `json:"deleteLocal"`
+	Job                 *gocron.Job        `json:"-"`
+	running             int32
+	paused              int32
 }
 
 func (b *Backup) clear() error {
-
-	tmp := "./tmp/" + b.stringID() + "/"
-	err := os.RemoveAll(tmp)
+	err := os.RemoveAll(b.tmpDir())
 	if err != nil {
 		return err
 	}
@@ -33,58 +45,234 @@ func (b *Backup) clear() error {
 
 func (b *Backup) CreateFunc() func() {
 	return func() {
-		b.StartedAt = time.Now()
-		b.ID = b.StartedAt.UnixNano()
+		if b.IsPaused() {
+			logger.Main.Infow("backup paused, run skipped", "name", b.Name)
+			return
+		}
+		if !b.Run() {
+			logger.Main.Warnw("backup still running, run skipped", "name", b.Name)
+		}
+	}
+}
+
+// Run runs the backup once. It returns false without running if a run is
+// already in progress.
+func (b *Backup) Run() bool {
+	if !atomic.CompareAndSwapInt32(&b.running, 0, 1) {
+		return false
+	}
+	defer atomic.StoreInt32(&b.running, 0)
+	b.run()
+	return true
+}
+
+// Start runs the backup once in the background. It returns false without
+// running if a run is already in progress.
+func (b *Backup) Start() bool {
+	if !atomic.CompareAndSwapInt32(&b.running, 0, 1) {
+		return false
+	}
+	go func() {
+		defer atomic.StoreInt32(&b.running, 0)
+		b.run()
+	}()
+	return true
+}
+
+func (b *Backup) IsRunning() bool {
+	return atomic.LoadInt32(&b.running) == 1
+}
+
+// Pause stops the scheduled runs until Resume, manual runs still work.
+func (b *Backup) Pause() {
+	atomic.StoreInt32(&b.paused, 1)
+}
 
-		logger.Main.Infow("backup started", "name", b.Name, "id", b.ID)
+func (b *Backup) Resume() {
+	atomic.StoreInt32(&b.paused, 0)
+}
+
+func (b *Backup) IsPaused() bool {
+	return atomic.LoadInt32(&b.paused) == 1
+}
+
+func (b *Backup) run() {
+	b.StartedAt = time.Now()
+	b.ID = b.StartedAt.UnixNano()
+	logger.StartCapture(b.ID)
+
+	logger.Main.Infow("backup started", "name", b.Name, "id", b.ID)
+
+	run := &history.Run{
+		Kind:      history.KindBackup,
+		Job:       b.Name,
+		ID:        b.ID,
+		StartedAt: b.StartedAt,
+	}
+	defer b.recordRun(run)
+	for _, dest := range b.destinations() {
+		dest.Result = DestinationResult{}
+	}
 
-		var err error
-		err = b.runSource()
+	callback := b.callback()
+	if callback.OnStart != "" {
+		started := time.Now()
+		err := b.callCallback(CallbackStarted, "")
+		run.AddStage("callback_start", started, err)
 		if err != nil {
-			logger.Main.Errorw("source error", "name", b.Name, "id", b.ID, "error", err)
-			return
+			logger.Main.Errorw("start callback error", "name", b.Name, "id", b.ID, "error", err)
+		} else {
+			logger.Main.Debugw("start callback success", "name", b.Name, "id", b.ID)
+		}
+	}
+
+	err := b.runStages(run)
+	run.Success = err == nil
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		logger.Main.Infow("backup success", "name", b.Name, "id", b.ID)
+	}
+
+	status := CallbackSuccess
+	if !run.Success {
+		status = CallbackFailed
+	}
+	if callback.url(status) == "" {
+		logger.Main.Debugw("callback none", "name", b.Name, "id", b.ID)
+	} else {
+		started := time.Now()
+		err = b.callCallback(status, run.Error)
+		run.AddStage("callback", started, err)
+		if err != nil {
+			logger.Main.Errorw("callback error", "name", b.Name, "id", b.ID, "error", err)
+		} else {
+			logger.Main.Debugw("callback success", "name", b.Name, "id", b.ID)
+		}
+	}
+
+	if b.DeleteLocal == nil || *b.DeleteLocal == true {
+		err = b.clear()
+		if err != nil {
+			logger.Main.Errorw("tmp clear error", "name", b.Name, "id", b.ID, "error", err)
 		} else {
-			logger.Main.Debugw("source success", "name", b.Name, "id", b.ID)
+			logger.Main.Debugw("tmp cleared", "name", b.Name, "id", b.ID)
 		}
+	} else {
+		logger.Main.Debugw("deleteLocal false", "name", b.Name, "id", b.ID)
+	}
 
-		err = b.runDestination()
+	logger.Main.Infow("backup finished", "name", b.Name, "id", b.ID)
+}
+
+// runStages runs the stages of the backup until one of them fails.
+func (b *Backup) runStages(run *history.Run) error {
+	started := time.Now()
+	err := b.runSource()
+	run.AddStage("source", started, err)
+	if err != nil {
+		logger.Main.Errorw("source error", "name", b.Name, "id", b.ID, "error", err)
+		return err
+	} else {
+		logger.Main.Debugw("source success", "name", b.Name, "id", b.ID)
+	}
+
+	if b.Archive != nil {
+		started = time.Now()
+		err = b.runArchive()
+		run.AddStage("archive", started, err)
 		if err != nil {
-			logger.Main.Errorw("backup error", "name", b.Name, "id", b.ID, "error", err)
+			logger.Main.Errorw("archive error", "name", b.Name, "id", b.ID, "error", err)
+			return err
 		} else {
-			logger.Main.Infow("backup success", "name", b.Name, "id", b.ID)
+			logger.Main.Debugw("archive success", "name", b.Name, "id", b.ID)
 		}
+	}
 
-		if b.CallbackURL == "" {
-			logger.Main.Debugw("callback none", "name", b.Name, "id", b.ID)
+	if b.Encryption != nil {
+		started = time.Now()
+		err = b.runEncryption()
+		run.AddStage("encryption", started, err)
+		if err != nil {
+			logger.Main.Errorw("encryption error", "name", b.Name, "id", b.ID, "error", err)
+			return err
 		} else {
-			err = b.callCallback()
-			if err != nil {
-				logger.Main.Errorw("callback error", "name", b.Name, "id", b.ID, "error", err)
-			} else {
-				logger.Main.Debugw("callback success", "name", b.Name, "id", b.ID)
-			}
+			logger.Main.Debugw("encryption success", "name", b.Name, "id", b.ID)
 		}
+	}
 
-		if b.DeleteLocal == nil || *b.DeleteLocal == true {
-			err = b.clear()
-			if err != nil {
-				logger.Main.Errorw("tmp clear error", "name", b.Name, "id", b.ID, "error", err)
-			} else {
-				logger.Main.Debugw("tmp cleared", "name", b.Name, "id", b.ID)
-			}
+	if b.manifestEnabled() {
+		started = time.Now()
+		err = b.runManifest()
+		run.AddStage("manifest", started, err)
+		if err != nil {
+			logger.Main.Errorw("manifest error", "name", b.Name, "id", b.ID, "error", err)
+			return err
 		} else {
-			logger.Main.Debugw("deleteLocal false", "name", b.Name, "id", b.ID)
+			logger.Main.Debugw("manifest success", "name", b.Name, "id", b.ID)
 		}
+	}
+
+	started = time.Now()
+	err = b.runDestination()
+	run.AddStage("destination", started, err)
+	if err != nil {
+		logger.Main.Errorw("backup error", "name", b.Name, "id", b.ID, "error", err)
+	}
+	return err
+}
+
+// recordRun saves the run with the source and destination results to the history.
+func (b *Backup) recordRun(run *history.Run) {
+	for _, src := range b.sources() {
+		run.Sources = append(run.Sources, history.Source{
+			Name:    src.displayName(),
+			Type:    src.Type,
+			Success: src.Result.Success,
+			Error:   src.Result.Error,
+		})
+	}
+	for _, dest := range b.destinations() {
+		run.Destinations = append(run.Destinations, history.Destination{
+			Name:     dest.displayName(),
+			Type:     dest.Type,
+			Success:  dest.Result.Success,
+			Error:    dest.Result.Error,
+			Files:    dest.Result.TotalUploadedFiles,
+			Bytes:    dest.Result.TotalUploadedSize,
+			Deleted:  dest.Result.DeletedFiles,
+			Warnings: dest.Result.Warnings,
+		})
+		run.Files += dest.Result.TotalUploadedFiles
+		run.Bytes += dest.Result.TotalUploadedSize
+		run.Deleted += len(dest.Result.DeletedFiles)
+	}
+	run.FinishedAt = time.Now()
+
+	previous, err := history.Last(b.Name, history.KindBackup)
+	if err != nil {
+		logger.Main.Errorw("history error", "name", b.Name, "id", b.ID, "error", err)
+	}
+	b.notify(run, previous)
 
-		logger.Main.Infow("backup finished", "name", b.Name, "id", b.ID)
+	run.Log = logger.StopCapture(b.ID)
+	err = history.Record(run)
+	if err != nil {
+		logger.Main.Errorw("history error", "name", b.Name, "id", b.ID, "error", err)
 	}
 }
 
+// getFileTimeFormat returns the date suffix of the file names, in the timezone
+// of the config like the dates parsed back by parseRemoteFileName.
 func (b *Backup) getFileTimeFormat() string {
-	return b.StartedAt.Format(config.Get().DateFormat)
+	return b.StartedAt.In(utils.TimeLocation).Format(config.Get().DateFormat)
 }
 
 func (b *Backup) stringID() string {
 	id := strconv.FormatInt(b.ID, 10)
 	return id
 }
+
+func (b *Backup) tmpDir() string {
+	return "./tmp/" + b.stringID() + "/"
+}
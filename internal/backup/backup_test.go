@@ -0,0 +1,153 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/history"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestDir returns the slash separated paths of the files under dir.
+func readTestDir(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, p)
+		files = append(files, filepath.ToSlash(relPath))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// TestRunLocal runs the whole pipeline from a local source to a local destination.
+func TestRunLocal(t *testing.T) {
+	// Own history, the runs of earlier test runs must not be counted
+	historyFile := filepath.Join(t.TempDir(), "history.db")
+	config.Set(&config.Config{DateFormat: testDateFormat, HistoryFile: &historyFile})
+	defer config.Set(&config.Config{DateFormat: testDateFormat})
+
+	src := t.TempDir()
+	target := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "db.sql"), "dump")
+	writeTestFile(t, filepath.Join(src, "files", "a.txt"), "a")
+	// Another job in the same target must not be touched by retention
+	writeTestFile(t, filepath.Join(target, "other-2001-01-01__00-00-00.txt"), "other")
+
+	keepLast := 2
+	b := &Backup{
+		Name: "e2e",
+		Source: SourceInfo{
+			Type: "local",
+			Info: map[string]interface{}{"paths": []string{filepath.Join(src, "db.sql"), filepath.Join(src, "files")}},
+		},
+		Destination: DestinationInfo{
+			Type: "local",
+			Info: DestinationLocalInfo{Target: target, RetentionInfo: RetentionInfo{KeepLast: &keepLast}},
+		},
+	}
+
+	var dates []string
+	for i := 0; i < 3; i++ {
+		waitNextSecond()
+		b.CreateFunc()()
+		if b.Destination.Result.TotalUploadedFiles != 3 {
+			t.Fatalf("run %d uploaded %d files, want 3", i, b.Destination.Result.TotalUploadedFiles)
+		}
+		dates = append(dates, b.getFileTimeFormat())
+	}
+
+	// Retention deletes the whole first run and leaves the other job alone
+	want := []string{"other-2001-01-01__00-00-00.txt"}
+	for _, date := range dates[1:] {
+		want = append(want, "db-"+date+".sql", "files/a-"+date+".txt", "manifest-"+date+".json")
+	}
+	sort.Strings(want)
+	if got := readTestDir(t, target); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("target has %q, want %q", got, want)
+	}
+	runs, err := history.List("e2e", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("history has %d runs, want 3", len(runs))
+	}
+	for _, run := range runs {
+		if !run.Success || run.Files != 3 {
+			t.Errorf("run %d: success %v, files %d", run.ID, run.Success, run.Files)
+		}
+	}
+	if runs[0].Deleted != 3 {
+		t.Errorf("last run deleted %d files, want 3", runs[0].Deleted)
+	}
+
+	data, err := os.ReadFile(filepath.Join(target, "db-"+dates[2]+".sql"))
+	if err != nil || string(data) != "dump" {
+		t.Errorf("db.sql = %q, %v", data, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(target, "manifest-"+dates[2]+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []ManifestFile{
+		// SHA-256 of "dump" and "a"
+		{Name: "db.sql", RemoteName: "db-" + dates[2] + ".sql", Size: 4, SHA256: "b6ca0868bca6a2926b70aa1a71592038d9030fe26d4214edcfbd6cf41f2f4654"},
+		{Name: "files/a.txt", RemoteName: "files/a-" + dates[2] + ".txt", Size: 1, SHA256: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"},
+	}
+	if manifest.BackupName != "e2e" || fmt.Sprint(manifest.Files) != fmt.Sprint(wantFiles) {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	lists, err := b.ListSnapshots("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || len(lists[0].Snapshots) != 2 || len(lists[0].Snapshots[1].Files) != 3 {
+		t.Fatalf("listed %+v, want 2 runs", lists)
+	}
+
+	to := t.TempDir()
+	snapshot, err := b.Restore(RestoreOptions{To: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Date != dates[2] {
+		t.Errorf("restored %s, want the latest run %s", snapshot.Date, dates[2])
+	}
+	for name, want := range map[string]string{"db.sql": "dump", "files/a.txt": "a"} {
+		data, err := os.ReadFile(filepath.Join(to, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Errorf("restored %s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
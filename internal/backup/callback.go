@@ -1,49 +1,228 @@
 package backup
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 )
 
-func (b *Backup) callCallback() error {
-	callbackUrl, err := url.Parse(b.CallbackURL)
+const (
+	CallbackStarted = "started"
+	CallbackSuccess = "success"
+	CallbackFailed  = "failed"
+)
+
+const (
+	defaultCallbackTimeout    = 10 * time.Second
+	defaultCallbackRetries    = 3
+	defaultCallbackRetryDelay = time.Second
+	defaultSignatureHeader    = "X-Backupper-Signature"
+)
+
+type CallbackInfo struct {
+	// URL is called when the backup finishes, onSuccess and onFailure override it.
+	URL       string            `json:"url"`
+	OnStart   string            `json:"onStart"`
+	OnSuccess string            `json:"onSuccess"`
+	OnFailure string            `json:"onFailure"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	// Body is a Go template of the callback payload, the payload is sent as JSON by default.
+	Body string `json:"body"`
+	// Secret signs the body with HMAC-SHA256 into signatureHeader as "sha256=<hex>".
+	Secret          string `json:"secret"`
+	SignatureHeader string `json:"signatureHeader"`
+	Timeout         string `json:"timeout"`
+	Retries         *int   `json:"retries"`
+	// RetryDelay is the delay before the first retry, it doubles after each one.
+	RetryDelay string `json:"retryDelay"`
+}
+
+// callback returns the callback of the backup, "callbackUrl" is the same as "callback.url".
+func (b *Backup) callback() CallbackInfo {
+	var info CallbackInfo
+	if b.Callback != nil {
+		info = *b.Callback
+	}
+	if info.URL == "" {
+		info.URL = b.CallbackURL
+	}
+	return info
+}
+
+// url returns the URL to call for the status, or "" if there is none.
+func (info *CallbackInfo) url(status string) string {
+	switch status {
+	case CallbackStarted:
+		return info.OnStart
+	case CallbackSuccess:
+		if info.OnSuccess != "" {
+			return info.OnSuccess
+		}
+	case CallbackFailed:
+		if info.OnFailure != "" {
+			return info.OnFailure
+		}
+	}
+	return info.URL
+}
+
+func parseCallbackDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// callCallback sends the payload of the run to the callback URL of the
+// status, failed requests are retried with an exponential backoff.
+func (b *Backup) callCallback(status string, runError string) error {
+	info := b.callback()
+	callbackUrl, err := url.Parse(info.url(status))
 	if err != nil {
 		return err
 	}
+	timeout, err := parseCallbackDuration(info.Timeout, defaultCallbackTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+	delay, err := parseCallbackDuration(info.RetryDelay, defaultCallbackRetryDelay)
+	if err != nil {
+		return fmt.Errorf("invalid retryDelay: %w", err)
+	}
+	retries := defaultCallbackRetries
+	if info.Retries != nil && *info.Retries >= 0 {
+		retries = *info.Retries
+	}
+	method := strings.ToUpper(info.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
 
-	postData := make(map[string]interface{})
-	postData["backup_date"] = b.StartedAt.Format(time.RFC3339)
-	postData["backup_ts"] = b.StartedAt.Unix()
-	postData["backup_id"] = b.stringID()
-	postData["backup_name"] = b.Name
-	postData["backup_source"] = b.Source.Type
-	postData["backup_destination"] = b.Destination.Type
-	postData["backup_destination_result"] = b.Destination.Result
-	postData["backup_duration"] = time.Since(b.StartedAt).String()
+	payload := b.callbackData(status, runError)
+	var body []byte
+	if info.Body != "" {
+		rendered, err := renderWebhookTemplate("body", info.Body, jsonData(payload))
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	} else {
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
 
-	jsonData, _ := json.Marshal(postData)
-	postDataBuffer := strings.NewReader(string(jsonData))
+	httpClient := http.Client{Timeout: timeout}
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = b.sendCallback(&httpClient, info, method, callbackUrl.String(), body)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+		logger.Main.Warnw("callback retry", "name", b.Name, "id", b.ID, "status", status, "attempt", attempt+1, "delay", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
 
-	httpClient := http.Client{}
-	req, err := http.NewRequest("POST", callbackUrl.String(), postDataBuffer)
+// sendCallback makes a single callback request. It reports whether a failed
+// request is worth retrying, client errors other than 408 and 429 aren't.
+func (b *Backup) sendCallback(httpClient *http.Client, info CallbackInfo, method string, callbackUrl string, body []byte) (bool, error) {
+	req, err := http.NewRequest(method, callbackUrl, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Backupper")
+	for key, value := range info.Headers {
+		req.Header.Set(key, value)
+	}
+	if info.Secret != "" {
+		header := info.SignatureHeader
+		if header == "" {
+			header = defaultSignatureHeader
+		}
+		mac := hmac.New(sha256.New, []byte(info.Secret))
+		mac.Write(body)
+		req.Header.Set(header, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return err
+		return true, err
 	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
 
-	if resp.StatusCode != 200 {
-		return err
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("callback error: %s", resp.Status)
+	}
+	return false, nil
+}
+
+// callbackData returns the callback payload of the current run.
+func (b *Backup) callbackData(status string, runError string) map[string]interface{} {
+	postData := make(map[string]interface{})
+	postData["backup_date"] = b.StartedAt.Format(time.RFC3339)
+	postData["backup_ts"] = b.StartedAt.Unix()
+	postData["backup_id"] = b.stringID()
+	postData["backup_name"] = b.Name
+	postData["backup_status"] = status
+	postData["backup_success"] = status == CallbackSuccess
+	postData["backup_error"] = runError
+	postData["backup_duration"] = time.Since(b.StartedAt).String()
+
+	var sources []map[string]interface{}
+	for _, src := range b.sources() {
+		sources = append(sources, map[string]interface{}{
+			"name":   src.displayName(),
+			"type":   src.Type,
+			"folder": src.Folder,
+			"result": src.Result,
+		})
 	}
+	postData["backup_sources"] = sources
+	if srcs := b.sources(); len(srcs) > 0 {
+		postData["backup_source"] = srcs[0].Type
+	}
+
+	var destinations []map[string]interface{}
+	for _, dest := range b.destinations() {
+		destinations = append(destinations, map[string]interface{}{
+			"name":   dest.displayName(),
+			"type":   dest.Type,
+			"result": dest.Result,
+		})
+	}
+	postData["backup_destinations"] = destinations
+	if dests := b.destinations(); len(dests) > 0 {
+		postData["backup_destination"] = dests[0].Type
+		postData["backup_destination_result"] = dests[0].Result
+	}
+
+	return postData
+}
 
-	return nil
+// jsonData decodes v like a JSON body for templates. Numbers are kept as
+// json.Number, large sizes would be printed as floats otherwise.
+func jsonData(v interface{}) map[string]interface{} {
+	raw, _ := json.Marshal(v)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	result := make(map[string]interface{})
+	_ = decoder.Decode(&result)
+	return result
 }
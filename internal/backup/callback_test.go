@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackURL(t *testing.T) {
+	info := CallbackInfo{URL: "http://default", OnSuccess: "http://success"}
+	tests := map[string]string{
+		CallbackStarted: "",
+		CallbackSuccess: "http://success",
+		CallbackFailed:  "http://default",
+	}
+	for status, want := range tests {
+		if got := info.url(status); got != want {
+			t.Errorf("url(%q) = %q, want %q", status, got, want)
+		}
+	}
+
+	b := &Backup{CallbackURL: "http://legacy"}
+	legacy := b.callback()
+	if got := legacy.url(CallbackFailed); got != "http://legacy" {
+		t.Errorf("callbackUrl = %q, want http://legacy", got)
+	}
+}
+
+func TestSendCallbackSignature(t *testing.T) {
+	server, requests := testHTTPServer(t)
+	body := []byte(`{"backup_name":"db"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		info   CallbackInfo
+		header string
+		want   string
+	}{
+		{CallbackInfo{Secret: "secret"}, defaultSignatureHeader, signature},
+		{CallbackInfo{Secret: "secret", SignatureHeader: "X-Hub-Signature-256"}, "X-Hub-Signature-256", signature},
+		{CallbackInfo{}, defaultSignatureHeader, ""},
+	}
+	b := &Backup{}
+	for _, test := range tests {
+		_, err := b.sendCallback(server.Client(), test.info, http.MethodPost, server.URL, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := (*requests)[len(*requests)-1]
+		if got := request.header.Get(test.header); got != test.want {
+			t.Errorf("%s = %q, want %q", test.header, got, test.want)
+		}
+		if string(request.body) != string(body) {
+			t.Errorf("body = %s", request.body)
+		}
+	}
+}
+
+func TestSendCallbackRetry(t *testing.T) {
+	server, _ := testHTTPServer(t)
+	b := &Backup{}
+	tests := []struct {
+		url   string
+		retry bool
+		err   bool
+	}{
+		{server.URL, false, false},
+		{server.URL + "/500", true, true},
+		{server.URL + "/400", false, true},
+		{"http://127.0.0.1:0", true, true},
+	}
+	for _, test := range tests {
+		retry, err := b.sendCallback(server.Client(), CallbackInfo{}, http.MethodPost, test.url, nil)
+		if retry != test.retry || (err != nil) != test.err {
+			t.Errorf("%s: retry = %v, error = %v", test.url, retry, err)
+		}
+	}
+}
+
+func TestCallCallback(t *testing.T) {
+	var attempts int
+	var request *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		request = r
+		body, _ = io.ReadAll(r.Body)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flaky") && attempts < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/400":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.URL.Path == "/503":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	b := &Backup{
+		Name:      "db",
+		StartedAt: time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC),
+		Destinations: []DestinationInfo{
+			{Type: "local", Result: DestinationResult{Success: true, TotalUploadedFiles: 2}},
+		},
+	}
+	b.ID = b.StartedAt.UnixNano()
+	retries := 2
+	tests := []struct {
+		name     string
+		info     CallbackInfo
+		status   string
+		attempts int
+		err      bool
+	}{
+		{"success", CallbackInfo{URL: server.URL + "/ok"}, CallbackSuccess, 1, false},
+		{"retried", CallbackInfo{URL: server.URL + "/flaky", RetryDelay: "1ms"}, CallbackSuccess, 3, false},
+		{"retries exhausted", CallbackInfo{URL: server.URL + "/503", RetryDelay: "1ms", Retries: &retries}, CallbackFailed, 3, true},
+		{"not retried", CallbackInfo{URL: server.URL + "/400", RetryDelay: "1ms"}, CallbackFailed, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts = 0
+			b.Callback = &test.info
+			err := b.callCallback(test.status, "")
+			if (err != nil) != test.err || attempts != test.attempts {
+				t.Errorf("attempts = %d, error = %v, want %d attempts", attempts, err, test.attempts)
+			}
+		})
+	}
+
+	// The payload is sent as JSON by default
+	b.Callback = &CallbackInfo{URL: server.URL}
+	err := b.callCallback(CallbackFailed, "disk full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]interface{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != http.MethodPost || payload["backup_name"] != "db" || payload["backup_status"] != CallbackFailed || payload["backup_error"] != "disk full" || payload["backup_destination"] != "local" {
+		t.Errorf("%s payload = %v", request.Method, payload)
+	}
+
+	// Method, headers and a body template
+	b.Callback = &CallbackInfo{
+		URL:     server.URL,
+		Method:  "put",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Body:    `{"job":{{json .backup_name}},"files":{{(index .backup_destinations 0).result.totalUploadedFiles}},"ts":{{.backup_ts}}}`,
+	}
+	err = b.callCallback(CallbackSuccess, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != http.MethodPut || request.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("request %s %v", request.Method, request.Header)
+	}
+	if want := `{"job":"db","files":2,"ts":1689849000}`; string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
@@ -1,26 +1,363 @@
 package backup
 
+import (
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/crypt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
 type DestinationResult struct {
-	TotalUploadedFiles int64 `json:"totalUploadedFiles"`
-	TotalUploadedSize  int64 `json:"totalUploadedSize"`
+	TotalUploadedFiles int64    `json:"totalUploadedFiles"`
+	TotalUploadedSize  int64    `json:"totalUploadedSize"`
+	TotalVerifiedFiles int64    `json:"totalVerifiedFiles"`
+	TotalRetries       int64    `json:"totalRetries"`
+	FailedFiles        []string `json:"failedFiles,omitempty"`
+	Warnings           []string `json:"warnings,omitempty"`
+	DeletedFiles       []string `json:"deletedFiles,omitempty"`
+	Success            bool     `json:"success"`
+	Error              string   `json:"error,omitempty"`
 }
 
 type DestinationInfo struct {
+	Name              string            `json:"name"`
 	Type              string            `json:"type"`
 	DeleteAfterUpload *bool             `json:"deleteAfterUpload"`
+	Verify            string            `json:"verify"`
+	Retries           *int              `json:"retries"`
 	Info              interface{}       `json:"info"`
 	Result            DestinationResult `json:"-"`
 }
 
+// RetentionInfo holds the retention rules shared by every destination type.
+// It is decoded from the same "info" object as the destination itself.
+type RetentionInfo struct {
+	LimitByDate  *string `json:"limitByDate"`
+	LimitByCount *int    `json:"limitByCount"`
+	LimitBySize  *int64  `json:"limitBySize"`
+	KeepLast     *int    `json:"keepLast"`
+	KeepHourly   *int    `json:"keepHourly"`
+	KeepDaily    *int    `json:"keepDaily"`
+	KeepWeekly   *int    `json:"keepWeekly"`
+	KeepMonthly  *int    `json:"keepMonthly"`
+	KeepYearly   *int    `json:"keepYearly"`
+	MinKeep      *int    `json:"minKeep"`
+}
+
+// Destination uploads the files of a backup run to a storage target.
+type Destination interface {
+	Connect(b *Backup) error
+	Upload(b *Backup, localPath string, remoteName string) error
+	Disconnect() error
+}
+
+// Deleter is implemented by destinations whose stored files can be deleted,
+// together with Lister it enables the retention rules.
+type Deleter interface {
+	Delete(remoteName string) error
+}
+
+// ErrVerifyNotSupported is returned by a SizeVerifier or HashVerifier that can't
+// check a file, e.g. an FTP server without the SIZE command. The file is left
+// unverified instead of failing the upload.
+var ErrVerifyNotSupported = errors.New("verification not supported")
+
+// SizeVerifier is implemented by destinations that can report the size of an uploaded file.
+type SizeVerifier interface {
+	RemoteSize(remoteName string) (int64, error)
+}
+
+// HashVerifier is implemented by destinations that can compute the SHA-256 of an uploaded file.
+type HashVerifier interface {
+	RemoteSHA256(remoteName string) (string, error)
+}
+
+// Lister is implemented by destinations whose stored files can be listed.
+// Names are slash separated and relative to the target.
+type Lister interface {
+	List() ([]RemoteFile, error)
+}
+
+// Downloader is implemented by destinations whose stored files can be downloaded back.
+type Downloader interface {
+	Download(remoteName string, localPath string) error
+}
+
+const (
+	VerifyNone = "none"
+	VerifySize = "size"
+	VerifyHash = "hash"
+)
+
+const defaultUploadRetries = 2
+
+// uploadRetryDelay is multiplied by the attempt number to wait before a retry.
+var uploadRetryDelay = 2 * time.Second
+
+// DestinationFactory builds a Destination from the raw "info" object of the config.
+type DestinationFactory func(info interface{}) (Destination, error)
+
+var (
+	destinationsMu sync.RWMutex
+	destinations   = make(map[string]DestinationFactory)
+)
+
+// RegisterDestination makes a destination type available to the "type" field of a backup destination.
+func RegisterDestination(destinationType string, factory DestinationFactory) {
+	destinationsMu.Lock()
+	defer destinationsMu.Unlock()
+	if factory == nil {
+		panic("backup: RegisterDestination factory is nil")
+	}
+	if _, dup := destinations[destinationType]; dup {
+		panic("backup: RegisterDestination called twice for type " + destinationType)
+	}
+	destinations[destinationType] = factory
+}
+
+func newDestination(dest DestinationInfo) (Destination, error) {
+	destinationsMu.RLock()
+	factory, ok := destinations[dest.Type]
+	destinationsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown destination type: %q", dest.Type)
+	}
+	return factory(dest.Info)
+}
+
+// destinations returns the single "destination" (if set) followed by the "destinations" list.
+func (b *Backup) destinations() []*DestinationInfo {
+	var dests []*DestinationInfo
+	if b.Destination.Type != "" {
+		dests = append(dests, &b.Destination)
+	}
+	for i := range b.Destinations {
+		dests = append(dests, &b.Destinations[i])
+	}
+	return dests
+}
+
+// quorum returns how many destinations must succeed for the backup to succeed.
+func (b *Backup) quorum(total int) int {
+	if b.DestinationQuorum != nil && *b.DestinationQuorum > 0 && *b.DestinationQuorum < total {
+		return *b.DestinationQuorum
+	}
+	return total
+}
+
 func (b *Backup) runDestination() error {
-	dest := b.Destination
-	switch dest.Type {
-	case "sftp":
-		return b.runDestinationSFTP()
-	case "ftp":
-		return b.runDestinationFTP()
-	case "telegram_bot":
-		return b.runDestinationTelegramBot()
+	dests := b.destinations()
+	if len(dests) == 0 {
+		return errors.New("no destination")
+	}
+
+	succeeded := 0
+	for _, dest := range dests {
+		err := b.uploadTo(dest)
+		if err != nil {
+			dest.Result.Error = err.Error()
+			logger.Main.Errorw("destination error", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "error", err)
+		} else {
+			dest.Result.Success = true
+			succeeded++
+			logger.Main.Debugw("destination success", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "files", dest.Result.TotalUploadedFiles, "size", dest.Result.TotalUploadedSize)
+		}
+	}
+
+	quorum := b.quorum(len(dests))
+	if succeeded < quorum {
+		return fmt.Errorf("%d of %d destinations succeeded (quorum %d)", succeeded, len(dests), quorum)
 	}
 	return nil
 }
+
+func (dest *DestinationInfo) displayName() string {
+	if dest.Name != "" {
+		return dest.Name
+	}
+	return dest.Type
+}
+
+func (b *Backup) uploadTo(dest *DestinationInfo) error {
+	dest.Result = DestinationResult{
+		TotalUploadedFiles: 0,
+		TotalUploadedSize:  0,
+	}
+
+	d, err := newDestination(*dest)
+	if err != nil {
+		return err
+	}
+
+	err = d.Connect(b)
+	if err != nil {
+		return err
+	}
+	defer d.Disconnect()
+
+	// Upload files in ./tmp/{id}/, keeping the folder structure
+	tmpDir := b.tmpDir()
+	uploadedData := 0
+	err = filepath.WalkDir(tmpDir, func(p string, file fs.DirEntry, err error) error {
+		if err != nil {
+			logger.Main.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
+			return err
+		}
+		if file.IsDir() {
+			return nil
+		}
+		fInfo, err := file.Info()
+		if err != nil {
+			logger.Main.Errorw("failed to backup because file info error", "name", b.Name, "id", b.ID, "file", p, "error", err)
+			return nil
+		}
+		relPath, err := filepath.Rel(tmpDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		err = b.uploadFile(d, dest, p, b.remoteFileName(relPath), fInfo.Size())
+		if err != nil {
+			dest.Result.FailedFiles = append(dest.Result.FailedFiles, relPath)
+			logger.Main.Errorw("upload error", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "file", relPath, "error", err)
+			return err
+		}
+		dest.Result.TotalUploadedFiles++
+		dest.Result.TotalUploadedSize += fInfo.Size()
+		if relPath != manifestFileName {
+			uploadedData++
+		}
+		logger.Main.Debugw("upload success", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "file", relPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Retention runs on its own schedule if there is one, and never after an empty upload
+	if b.PruneCronExpression == "" && utils.ConvertToStruct[RetentionInfo](dest.Info).enabled() {
+		if uploadedData == 0 {
+			logger.Main.Warnw("retention skipped because nothing was uploaded", "name", b.Name, "id", b.ID, "destination", dest.displayName())
+			dest.Result.Warnings = append(dest.Result.Warnings, "retention skipped: nothing was uploaded")
+		} else {
+			b.applyRetention(d, dest)
+		}
+	}
+	return nil
+}
+
+// uploadFile uploads and verifies a file, failed attempts are retried.
+func (b *Backup) uploadFile(d Destination, dest *DestinationInfo, localPath string, remoteName string, size int64) error {
+	retries := defaultUploadRetries
+	if dest.Retries != nil && *dest.Retries >= 0 {
+		retries = *dest.Retries
+	}
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			dest.Result.TotalRetries++
+			logger.Main.Warnw("upload retry", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "file", remoteName, "attempt", attempt, "error", err)
+			time.Sleep(time.Duration(attempt) * uploadRetryDelay)
+		}
+
+		err = d.Upload(b, localPath, remoteName)
+		if err != nil {
+			continue
+		}
+
+		var verified bool
+		verified, err = b.verifyUpload(d, dest.Verify, localPath, remoteName, size)
+		if err != nil {
+			logger.Main.Errorw("upload verify error", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "file", remoteName, "error", err)
+			continue
+		}
+		if verified {
+			dest.Result.TotalVerifiedFiles++
+		}
+		return nil
+	}
+	return err
+}
+
+// verifyUpload compares the uploaded file with the local one. It reports false
+// if the destination can't check the file or verification is disabled.
+func (b *Backup) verifyUpload(d Destination, mode string, localPath string, remoteName string, size int64) (bool, error) {
+	if mode == "" {
+		mode = VerifySize
+	}
+	if mode == VerifyNone {
+		return false, nil
+	}
+	if mode != VerifySize && mode != VerifyHash {
+		return false, fmt.Errorf("unknown verify mode: %q", mode)
+	}
+
+	verified := false
+	if v, ok := d.(SizeVerifier); ok {
+		remoteSize, err := v.RemoteSize(remoteName)
+		if err != nil && !errors.Is(err, ErrVerifyNotSupported) {
+			return false, err
+		}
+		if err == nil {
+			if remoteSize != size {
+				return false, fmt.Errorf("size mismatch: local %d bytes, remote %d bytes", size, remoteSize)
+			}
+			verified = true
+		}
+	}
+
+	if v, ok := d.(HashVerifier); ok && mode == VerifyHash {
+		localHash, _, err := utils.FileSHA256(localPath)
+		if err != nil {
+			return false, err
+		}
+		remoteHash, err := v.RemoteSHA256(remoteName)
+		if err != nil && !errors.Is(err, ErrVerifyNotSupported) {
+			return false, err
+		}
+		if err == nil {
+			if !strings.EqualFold(localHash, remoteHash) {
+				return false, fmt.Errorf("sha256 mismatch: local %s, remote %s", localHash, remoteHash)
+			}
+			verified = true
+		}
+	}
+	return verified, nil
+}
+
+var compoundExts = []string{".tar.gz", ".tar.zst", ".tar.xz", ".tar.bz2"}
+
+// splitExt splits a file name into base name and extension, keeping compound
+// extensions like ".tar.gz" or ".sql.age" together.
+func splitExt(name string) (string, string) {
+	for _, ext := range []string{crypt.Extension(crypt.FormatAge), crypt.Extension(crypt.FormatGPG)} {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			base, innerExt := splitExt(strings.TrimSuffix(name, ext))
+			return base, innerExt + ext
+		}
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range compoundExts {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)], name[len(name)-len(ext):]
+		}
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// remoteFileName appends the backup date to the file name of a slash separated
+// path relative to the tmp directory, e.g. "db/dump.sql" -> "db/dump-<date>.sql".
+func (b *Backup) remoteFileName(relPath string) string {
+	dir, name := path.Split(relPath)
+	fileBaseName, fileExtension := splitExt(name)
+	return dir + fileBaseName + "-" + b.getFileTimeFormat() + fileExtension
+}
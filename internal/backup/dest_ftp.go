@@ -1,6 +1,8 @@
 package backup
 
 import (
+	"errors"
+	ftp2 "github.com/jlaffaye/ftp"
 	"github.com/xacnio/backupper/internal/utils"
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"github.com/xacnio/backupper/pkg/ftp"
@@ -10,116 +12,128 @@ import (
 )
 
 type DestinationFTPInfo struct {
-	Host         string  `json:"host"`
-	Port         int     `json:"port"`
-	User         string  `json:"user"`
-	Pass         string  `json:"pass"`
-	Target       string  `json:"target"`
-	LimitByDate  *string `json:"limitByDate"`
-	LimitByCount *int    `json:"limitByCount"`
-	LimitBySize  *uint64 `json:"limitBySize"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	User   string `json:"user"`
+	Pass   string `json:"pass"`
+	Target string `json:"target"`
+	RetentionInfo
 }
 
-func (b *Backup) runDestinationFTP() error {
-	destination := b.Destination
-	info := utils.ConvertToStruct[DestinationFTPInfo](destination.Info)
+type destinationFTP struct {
+	info DestinationFTPInfo
+	conn *ftp.FTP
+}
 
-	b.Destination.Result = DestinationResult{
-		TotalUploadedFiles: 0,
-		TotalUploadedSize:  0,
-	}
+func init() {
+	RegisterDestination("ftp", func(info interface{}) (Destination, error) {
+		return &destinationFTP{info: utils.ConvertToStruct[DestinationFTPInfo](info)}, nil
+	})
+}
 
-	conn := ftp.New(ftp.ConnConfig{
+func (d *destinationFTP) Connect(b *Backup) error {
+	info := d.info
+
+	d.conn = ftp.New(ftp.ConnConfig{
 		Host: info.Host,
 		Port: info.Port,
 		User: info.User,
 		Pass: info.Pass,
 	})
-	err := conn.Connect()
+	err := d.conn.Connect()
 	if err != nil {
 		logger.FTP.Errorw("connection error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err)
 		return err
 	}
-	defer conn.Disconnect()
 
 	// Create target folder
 	folders := strings.Split(info.Target, "/")
 	for i := 0; i < len(folders); i++ {
 		folder := strings.Join(folders[:i+1], "/")
-		_ = conn.MakeDir(folder)
+		_ = d.conn.MakeDir(folder)
 	}
 
 	// Go to target folder
-	err = conn.ChangeDir(info.Target)
+	err = d.conn.ChangeDir(info.Target)
 	if err != nil {
+		d.conn.Disconnect()
 		logger.FTP.Errorw("change directory error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err)
 		return err
 	}
+	return nil
+}
 
-	// List files in ./tmp/{id}/
-	tmpDir := "./tmp/" + b.stringID() + "/"
-	files, err := os.ReadDir(tmpDir)
+func (d *destinationFTP) Upload(b *Backup, localPath string, remoteName string) error {
+	f, err := os.Open(localPath)
 	if err != nil {
-		logger.FTP.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
 		return err
 	}
+	defer f.Close()
 
-	// Upload files
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		f, err := os.Open(tmpDir + file.Name())
-		if err != nil {
-			logger.Main.Errorw("failed to backup because open file error", "name", b.Name, "id", b.ID)
-			continue
-		}
-		fileBaseName := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
-		fileExtension := path.Ext(file.Name())
-		remoteFileName := fileBaseName + "-" + b.getFileTimeFormat() + fileExtension
-		err = conn.Stor(remoteFileName, f)
-		if err != nil {
-			f.Close()
-			logger.FTP.Errorw("upload error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err)
-			return err
-		} else {
-			logger.FTP.Debugw("upload success", "name", b.Name, "id", b.ID, "file", file.Name())
-
-			fInfo, err := f.Stat()
-			if err == nil {
-				b.Destination.Result.TotalUploadedFiles++
-				b.Destination.Result.TotalUploadedSize += fInfo.Size()
-			}
-
-			f.Close()
+	// Create sub folders relative to the target folder
+	if dir := path.Dir(remoteName); dir != "." {
+		folders := strings.Split(dir, "/")
+		for i := 0; i < len(folders); i++ {
+			_ = d.conn.MakeDir(strings.Join(folders[:i+1], "/"))
 		}
 	}
 
-	if info.LimitByCount != nil && *info.LimitByCount > 0 {
-		deleted, err := conn.LimitByFileCount(info.Target, *info.LimitByCount)
-		if err != nil {
-			logger.FTP.Errorw("limit by count error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err, "limit", *info.LimitByCount)
-		} else {
-			logger.FTP.Infow("limit by count success", "name", b.Name, "id", b.ID, "limit", *info.LimitByCount, "deleted", deleted)
-		}
+	err = d.conn.Stor(remoteName, f)
+	if err != nil {
+		logger.FTP.Errorw("upload error", "name", b.Name, "id", b.ID, "host", d.info.Host, "port", d.info.Port, "error", err)
+		return err
 	}
+	logger.FTP.Debugw("upload success", "name", b.Name, "id", b.ID, "file", remoteName)
+	return nil
+}
 
-	if info.LimitBySize != nil && *info.LimitBySize > 0 {
-		deleted, err := conn.LimitByLength(info.Target, *info.LimitBySize)
-		if err != nil {
-			logger.FTP.Errorw("limit by size error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err, "limit", *info.LimitBySize)
-		} else {
-			logger.FTP.Infow("limit by size success", "name", b.Name, "id", b.ID, "limit", *info.LimitBySize, "deleted", deleted)
+func (d *destinationFTP) Disconnect() error {
+	return d.conn.Disconnect()
+}
+
+func (d *destinationFTP) List() ([]RemoteFile, error) {
+	target := path.Clean(d.info.Target)
+	var files []RemoteFile
+	walker := d.conn.Walk(target)
+	for walker.Next() {
+		if walker.Err() != nil {
+			return nil, walker.Err()
+		}
+		entry := walker.Stat()
+		if entry.Type != ftp2.EntryTypeFile {
+			continue
 		}
+		files = append(files, RemoteFile{
+			Name:    strings.TrimPrefix(strings.TrimPrefix(walker.Path(), target), "/"),
+			Size:    int64(entry.Size),
+			ModTime: entry.Time,
+		})
 	}
+	return files, walker.Err()
+}
 
-	if info.LimitByDate != nil {
-		deleted, err := conn.LimitByDate(info.Target, *info.LimitByDate)
-		if err != nil {
-			logger.FTP.Errorw("limit by date error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err, "limit", *info.LimitByDate)
-		} else {
-			logger.FTP.Infow("limit by date success", "name", b.Name, "id", b.ID, "limit", *info.LimitByDate, "deleted", deleted)
-		}
+func (d *destinationFTP) Download(remoteName string, localPath string) error {
+	return d.conn.Download(remoteName, localPath)
+}
+
+func (d *destinationFTP) RemoteSize(remoteName string) (int64, error) {
+	size, err := d.conn.RemoteSize(remoteName)
+	if errors.Is(err, ftp.ErrNotSupported) {
+		return 0, ErrVerifyNotSupported
 	}
-	return nil
+	return size, err
+}
+
+// RemoteSHA256 uses the HASH command if the server has it, otherwise the file is read back.
+func (d *destinationFTP) RemoteSHA256(remoteName string) (string, error) {
+	hash, err := d.conn.HashSHA256(path.Join(d.info.Target, remoteName))
+	if err != nil {
+		logger.FTP.Debugw("hash command failed, reading back", "file", remoteName, "error", err)
+		return d.conn.SHA256(remoteName)
+	}
+	return hash, nil
+}
+
+func (d *destinationFTP) Delete(remoteName string) error {
+	return d.conn.Delete(remoteName)
 }
@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/local"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type DestinationLocalInfo struct {
+	Target string `json:"target"`
+	RetentionInfo
+}
+
+type destinationLocal struct {
+	info DestinationLocalInfo
+}
+
+func init() {
+	RegisterDestination("local", func(info interface{}) (Destination, error) {
+		return &destinationLocal{info: utils.ConvertToStruct[DestinationLocalInfo](info)}, nil
+	})
+}
+
+func (d *destinationLocal) Connect(b *Backup) error {
+	// Create target folder
+	err := os.MkdirAll(d.info.Target, 0777)
+	if err != nil {
+		logger.Local.Errorw("target directory error", "name", b.Name, "id", b.ID, "target", d.info.Target, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (d *destinationLocal) Upload(b *Backup, localPath string, remoteName string) error {
+	err := local.CopyFile(localPath, filepath.Join(d.info.Target, filepath.FromSlash(remoteName)))
+	if err != nil {
+		logger.Local.Errorw("copy error", "name", b.Name, "id", b.ID, "target", d.info.Target, "error", err)
+		return err
+	}
+	logger.Local.Debugw("copy success", "name", b.Name, "id", b.ID, "file", remoteName)
+	return nil
+}
+
+func (d *destinationLocal) Disconnect() error {
+	return nil
+}
+
+func (d *destinationLocal) List() ([]RemoteFile, error) {
+	var files []RemoteFile
+	err := filepath.WalkDir(d.info.Target, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(d.info.Target, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, RemoteFile{
+			Name:    filepath.ToSlash(relPath),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+func (d *destinationLocal) Download(remoteName string, localPath string) error {
+	return local.CopyFile(filepath.Join(d.info.Target, filepath.FromSlash(remoteName)), localPath)
+}
+
+func (d *destinationLocal) RemoteSize(remoteName string) (int64, error) {
+	info, err := os.Stat(filepath.Join(d.info.Target, filepath.FromSlash(remoteName)))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (d *destinationLocal) RemoteSHA256(remoteName string) (string, error) {
+	hash, _, err := utils.FileSHA256(filepath.Join(d.info.Target, filepath.FromSlash(remoteName)))
+	return hash, err
+}
+
+func (d *destinationLocal) Delete(remoteName string) error {
+	return os.Remove(filepath.Join(d.info.Target, filepath.FromSlash(remoteName)))
+}
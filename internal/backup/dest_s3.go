@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/s3"
+	"path"
+	"strings"
+)
+
+// S3ConnInfo holds the connection settings shared by the S3 source and destination.
+type S3ConnInfo struct {
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	AccessKey    string `json:"accessKey"`
+	SecretKey    string `json:"secretKey"`
+	SessionToken string `json:"sessionToken"`
+	UseSSL       *bool  `json:"useSSL"`
+	PathStyle    bool   `json:"pathStyle"`
+}
+
+type DestinationS3Info struct {
+	S3ConnInfo
+	Prefix       string `json:"prefix"`
+	StorageClass string `json:"storageClass"`
+	PartSize     uint64 `json:"partSize"`
+	RetentionInfo
+}
+
+type destinationS3 struct {
+	info DestinationS3Info
+	conn *s3.S3
+}
+
+func init() {
+	RegisterDestination("s3", func(info interface{}) (Destination, error) {
+		return &destinationS3{info: utils.ConvertToStruct[DestinationS3Info](info)}, nil
+	})
+}
+
+func (i S3ConnInfo) newConn() *s3.S3 {
+	return s3.New(s3.ConnConfig{
+		Endpoint:     i.Endpoint,
+		Region:       i.Region,
+		Bucket:       i.Bucket,
+		AccessKey:    i.AccessKey,
+		SecretKey:    i.SecretKey,
+		SessionToken: i.SessionToken,
+		UseSSL:       i.UseSSL == nil || *i.UseSSL,
+		PathStyle:    i.PathStyle,
+	})
+}
+
+// s3Prefix normalizes a configured prefix to the "folder/" form used in object keys.
+func s3Prefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+func (d *destinationS3) Connect(b *Backup) error {
+	info := d.info
+
+	d.conn = info.newConn()
+	err := d.conn.Connect()
+	if err != nil {
+		logger.S3.Errorw("connection error", "name", b.Name, "id", b.ID, "endpoint", info.Endpoint, "bucket", info.Bucket, "error", err)
+		return err
+	}
+
+	logger.S3.Debugw("connection success", "name", b.Name, "id", b.ID, "endpoint", info.Endpoint, "bucket", info.Bucket)
+	return nil
+}
+
+func (d *destinationS3) Upload(b *Backup, localPath string, remoteName string) error {
+	key := path.Join(s3Prefix(d.info.Prefix), remoteName)
+	_, err := d.conn.Upload(key, localPath, d.info.StorageClass, d.info.PartSize)
+	if err != nil {
+		logger.S3.Errorw("upload error", "name", b.Name, "id", b.ID, "endpoint", d.info.Endpoint, "bucket", d.info.Bucket, "key", key, "error", err)
+		return err
+	}
+	logger.S3.Debugw("upload success", "name", b.Name, "id", b.ID, "key", key)
+	return nil
+}
+
+func (d *destinationS3) Disconnect() error {
+	return d.conn.Disconnect()
+}
+
+func (d *destinationS3) List() ([]RemoteFile, error) {
+	prefix := s3Prefix(d.info.Prefix)
+	objects, err := d.conn.List(prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	var files []RemoteFile
+	for _, object := range objects {
+		files = append(files, RemoteFile{
+			Name:    strings.TrimPrefix(object.Key, prefix),
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
+	}
+	return files, nil
+}
+
+func (d *destinationS3) Download(remoteName string, localPath string) error {
+	return d.conn.Download(path.Join(s3Prefix(d.info.Prefix), remoteName), localPath)
+}
+
+func (d *destinationS3) RemoteSize(remoteName string) (int64, error) {
+	return d.conn.FileSize(path.Join(s3Prefix(d.info.Prefix), remoteName))
+}
+
+func (d *destinationS3) RemoteSHA256(remoteName string) (string, error) {
+	return d.conn.SHA256(path.Join(s3Prefix(d.info.Prefix), remoteName))
+}
+
+func (d *destinationS3) Delete(remoteName string) error {
+	return d.conn.Delete(path.Join(s3Prefix(d.info.Prefix), remoteName))
+}
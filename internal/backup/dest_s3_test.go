@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"bytes"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testS3Server starts an in-process S3 server with the buckets.
+func testS3Server(t *testing.T, buckets ...string) (S3ConnInfo, *s3mem.Backend) {
+	t.Helper()
+	backend := s3mem.New()
+	for _, bucket := range buckets {
+		err := backend.CreateBucket(bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := gofakes3.New(backend).Server()
+	// minio sends an empty delimiter on recursive listings, which gofakes3
+	// takes as a delimiter and lists only the common prefix
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if values, ok := query["delimiter"]; ok && values[0] == "" {
+			query.Del("delimiter")
+			r.URL.RawQuery = query.Encode()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	useSSL := false
+	return S3ConnInfo{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    "us-east-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+		UseSSL:    &useSSL,
+		PathStyle: true,
+	}, backend
+}
+
+func putTestObject(t *testing.T, backend *s3mem.Backend, bucket string, key string, data string) {
+	t.Helper()
+	// gofakes3 sets Last-Modified on uploads, minio fails to get objects without it
+	meta := map[string]string{"Last-Modified": time.Now().UTC().Format(http.TimeFormat)}
+	_, err := backend.PutObject(bucket, key, meta, bytes.NewReader([]byte(data)), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listTestObjects(t *testing.T, backend *s3mem.Backend, bucket string) []string {
+	t.Helper()
+	list, err := backend.ListBucket(bucket, nil, gofakes3.ListBucketPage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, object := range list.Contents {
+		keys = append(keys, object.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDestinationS3(t *testing.T) {
+	conn, backend := testS3Server(t, "backups")
+	conn.Bucket = "backups"
+	putTestObject(t, backend, "backups", "other/dump-2001-01-01__00-00-00.sql", "other")
+
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "db.sql"), "dump")
+
+	keepLast := 1
+	b := &Backup{
+		Name:   "s3",
+		Source: SourceInfo{Type: "local", Info: SourceLocalInfo{Paths: []string{filepath.Join(src, "db.sql")}}},
+		Destination: DestinationInfo{
+			Type: "s3",
+			Info: DestinationS3Info{S3ConnInfo: conn, Prefix: "/jobs/db/", RetentionInfo: RetentionInfo{KeepLast: &keepLast}},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		waitNextSecond()
+		b.CreateFunc()()
+		if b.Destination.Result.TotalUploadedFiles != 2 {
+			t.Fatalf("run %d uploaded %d files, want 2", i, b.Destination.Result.TotalUploadedFiles)
+		}
+	}
+
+	// Only the last run is kept, keys outside of the prefix are left alone
+	date := b.getFileTimeFormat()
+	want := []string{"jobs/db/db-" + date + ".sql", "jobs/db/manifest-" + date + ".json", "other/dump-2001-01-01__00-00-00.sql"}
+	if got := listTestObjects(t, backend, "backups"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("objects = %q, want %q", got, want)
+	}
+
+	to := t.TempDir()
+	_, err := b.Restore(RestoreOptions{To: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(to, "db.sql"))
+	if err != nil || string(data) != "dump" {
+		t.Errorf("restored db.sql = %q, %v", data, err)
+	}
+}
+
+func TestDestinationS3MissingBucket(t *testing.T) {
+	conn, _ := testS3Server(t)
+	conn.Bucket = "missing"
+	d, err := newDestination(DestinationInfo{Type: "s3", Info: DestinationS3Info{S3ConnInfo: conn}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Connect(&Backup{Name: "s3"})
+	if err == nil {
+		t.Error("connect to a missing bucket didn't fail")
+	}
+}
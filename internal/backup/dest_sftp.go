@@ -10,28 +10,31 @@ import (
 )
 
 type DestinationSFTPInfo struct {
-	Host           string  `json:"host"`
-	Port           int     `json:"port"`
-	User           string  `json:"user"`
-	Pass           string  `json:"pass"`
-	PrivateKeyFile string  `json:"privateKeyFile"`
-	Passphrase     string  `json:"passphrase"`
-	Target         string  `json:"target"`
-	LimitByDate    *string `json:"limitByDate"`
-	LimitByCount   *int    `json:"limitByCount"`
-	LimitBySize    *int64  `json:"limitBySize"`
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	User           string `json:"user"`
+	Pass           string `json:"pass"`
+	PrivateKeyFile string `json:"privateKeyFile"`
+	Passphrase     string `json:"passphrase"`
+	Target         string `json:"target"`
+	RetentionInfo
 }
 
-func (b *Backup) runDestinationSFTP() error {
-	destination := b.Destination
-	info := utils.ConvertToStruct[DestinationSFTPInfo](destination.Info)
+type destinationSFTP struct {
+	info     DestinationSFTPInfo
+	sftpConn *sftp.SFTP
+}
 
-	b.Destination.Result = DestinationResult{
-		TotalUploadedFiles: 0,
-		TotalUploadedSize:  0,
-	}
+func init() {
+	RegisterDestination("sftp", func(info interface{}) (Destination, error) {
+		return &destinationSFTP{info: utils.ConvertToStruct[DestinationSFTPInfo](info)}, nil
+	})
+}
+
+func (d *destinationSFTP) Connect(b *Backup) error {
+	info := d.info
 
-	sftpConn := sftp.New(sftp.ConnConfig{
+	d.sftpConn = sftp.New(sftp.ConnConfig{
 		Host:       info.Host,
 		Port:       info.Port,
 		User:       info.User,
@@ -40,94 +43,83 @@ func (b *Backup) runDestinationSFTP() error {
 		Passphrase: info.Passphrase,
 	})
 
-	err := sftpConn.Connect()
+	err := d.sftpConn.Connect()
 	if err != nil {
 		logger.SFTP.Errorw("connection error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err)
 		return err
 	}
 
-	defer sftpConn.Disconnect()
-
 	logger.SFTP.Debugw("connection success", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port)
 
 	// Create target folder
-	_ = sftpConn.Client.MkdirAll(info.Target)
+	_ = d.sftpConn.Client.MkdirAll(info.Target)
+	return nil
+}
 
-	// List files in ./tmp/{id}/
-	tmpDir := "./tmp/" + b.stringID() + "/"
-	files, err := os.ReadDir(tmpDir)
+func (d *destinationSFTP) Upload(b *Backup, localPath string, remoteName string) error {
+	f, err := os.Open(localPath)
 	if err != nil {
-		logger.FTP.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
 		return err
 	}
+	defer f.Close()
 
-	// Upload files
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		f, err := os.Open(tmpDir + file.Name())
-		if err != nil {
-			logger.Main.Errorw("failed to backup because open file error", "name", b.Name, "id", b.ID)
-			continue
-		}
-		fileBaseName := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
-		fileExtension := path.Ext(file.Name())
-		remoteFileName := fileBaseName + "-" + b.getFileTimeFormat() + fileExtension
-		remoteFile, err := sftpConn.Client.Create(info.Target + "/" + remoteFileName)
-		if err != nil {
-			f.Close()
-			logger.SFTP.Errorw("upload error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err)
-			return err
-		} else {
-			_, err = remoteFile.ReadFrom(f)
-			if err != nil {
-				f.Close()
-				remoteFile.Close()
-				logger.SFTP.Errorw("upload error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err)
-				return err
-			}
-
-			info2, err := remoteFile.Stat()
-			if err == nil {
-				b.Destination.Result.TotalUploadedFiles += 1
-				b.Destination.Result.TotalUploadedSize += info2.Size()
-			} else {
-				logger.Main.Errorw("file info error", "name", b.Name, "id", b.ID, "error", err)
-			}
-
-			remoteFile.Close()
-			f.Close()
-
-			logger.SFTP.Debugw("upload success", "name", b.Name, "id", b.ID, "file", file.Name())
-		}
-	}
+	remotePath := d.info.Target + "/" + remoteName
+	_ = d.sftpConn.Client.MkdirAll(path.Dir(remotePath))
 
-	if info.LimitByCount != nil && *info.LimitByCount > 0 {
-		deleted, err := sftpConn.LimitByFileCount(info.Target, *info.LimitByCount)
-		if err != nil {
-			logger.SFTP.Errorw("limit by count error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err, "limit", *info.LimitByCount)
-		} else {
-			logger.SFTP.Infow("limit by count success", "name", b.Name, "id", b.ID, "limit", *info.LimitByCount, "deleted", deleted)
-		}
+	remoteFile, err := d.sftpConn.Client.Create(remotePath)
+	if err != nil {
+		logger.SFTP.Errorw("upload error", "name", b.Name, "id", b.ID, "host", d.info.Host, "port", d.info.Port, "error", err)
+		return err
 	}
+	defer remoteFile.Close()
 
-	if info.LimitBySize != nil && *info.LimitBySize > 0 {
-		deleted, err := sftpConn.LimitByLength(info.Target, *info.LimitBySize)
-		if err != nil {
-			logger.SFTP.Errorw("limit by size error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err, "limit", *info.LimitBySize)
-		} else {
-			logger.SFTP.Infow("limit by size success", "name", b.Name, "id", b.ID, "limit", *info.LimitBySize, "deleted", deleted)
-		}
+	_, err = remoteFile.ReadFrom(f)
+	if err != nil {
+		logger.SFTP.Errorw("upload error", "name", b.Name, "id", b.ID, "host", d.info.Host, "port", d.info.Port, "error", err)
+		return err
 	}
 
-	if info.LimitByDate != nil {
-		deleted, err := sftpConn.LimitByDate(info.Target, *info.LimitByDate)
-		if err != nil {
-			logger.SFTP.Errorw("limit by date error", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port, "error", err, "limit", *info.LimitByDate)
-		} else {
-			logger.SFTP.Infow("limit by date success", "name", b.Name, "id", b.ID, "limit", *info.LimitByDate, "deleted", deleted)
+	logger.SFTP.Debugw("upload success", "name", b.Name, "id", b.ID, "file", remoteName)
+	return nil
+}
+
+func (d *destinationSFTP) Disconnect() error {
+	return d.sftpConn.Disconnect()
+}
+
+func (d *destinationSFTP) List() ([]RemoteFile, error) {
+	target := path.Clean(d.info.Target)
+	var files []RemoteFile
+	walker := d.sftpConn.Client.Walk(target)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return nil, walker.Err()
+		}
+		stat := walker.Stat()
+		if !stat.Mode().IsRegular() {
+			continue
 		}
+		files = append(files, RemoteFile{
+			Name:    strings.TrimPrefix(strings.TrimPrefix(walker.Path(), target), "/"),
+			Size:    stat.Size(),
+			ModTime: stat.ModTime(),
+		})
 	}
-	return nil
+	return files, nil
+}
+
+func (d *destinationSFTP) Download(remoteName string, localPath string) error {
+	return d.sftpConn.DownloadFile(d.info.Target+"/"+remoteName, localPath)
+}
+
+func (d *destinationSFTP) RemoteSize(remoteName string) (int64, error) {
+	return d.sftpConn.FileSize(d.info.Target + "/" + remoteName)
+}
+
+func (d *destinationSFTP) RemoteSHA256(remoteName string) (string, error) {
+	return d.sftpConn.SHA256(d.info.Target + "/" + remoteName)
+}
+
+func (d *destinationSFTP) Delete(remoteName string) error {
+	return d.sftpConn.Client.Remove(d.info.Target + "/" + remoteName)
 }
@@ -2,12 +2,15 @@ package backup
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/xacnio/backupper/internal/utils"
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"io"
 	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path"
 )
@@ -15,89 +18,118 @@ import (
 type DestinationTelegramInfo struct {
 	Token  string `json:"token"`
 	ChatID string `json:"chatID"`
+	APIURL string `json:"apiUrl"`
 }
 
-func (b *Backup) runDestinationTelegramBot() error {
-	destination := b.Destination
-	info := utils.ConvertToStruct[DestinationTelegramInfo](destination.Info)
+type destinationTelegramBot struct {
+	info  DestinationTelegramInfo
+	sizes map[string]int64
+}
+
+type telegramSendDocumentResponse struct {
+	Ok     bool `json:"ok"`
+	Result struct {
+		Document struct {
+			FileSize *int64 `json:"file_size"`
+		} `json:"document"`
+	} `json:"result"`
+}
+
+func init() {
+	RegisterDestination("telegram_bot", func(info interface{}) (Destination, error) {
+		return &destinationTelegramBot{
+			info:  utils.ConvertToStruct[DestinationTelegramInfo](info),
+			sizes: make(map[string]int64),
+		}, nil
+	})
+}
+
+func (d *destinationTelegramBot) Connect(b *Backup) error {
+	return nil
+}
 
-	b.Destination.Result = DestinationResult{
-		TotalUploadedFiles: 0,
-		TotalUploadedSize:  0,
+func (d *destinationTelegramBot) Upload(b *Backup, localPath string, remoteName string) error {
+	info := d.info
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		logger.Main.Errorw("failed to backup because open file error", "name", b.Name, "id", b.ID)
+		return err
 	}
+	defer f.Close()
 
-	// List files in ./tmp/{id}/
-	tmpDir := "./tmp/" + b.stringID() + "/"
-	files, err := os.ReadDir(tmpDir)
+	// Create request body
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	writer.WriteField("chat_id", info.ChatID)
+	part, err := writer.CreateFormFile("document", path.Base(f.Name()))
+	if err != nil {
+		logger.Main.Errorw("failed to backup because create form file error", "name", b.Name, "id", b.ID)
+		return err
+	}
+	_, err = io.Copy(part, f)
 	if err != nil {
-		logger.FTP.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
+		logger.Main.Errorw("failed to backup because copy file error", "name", b.Name, "id", b.ID)
 		return err
 	}
+	writer.Close()
 
-	// Loop through files
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		f, err := os.Open(tmpDir + file.Name())
-		if err != nil {
-			logger.Main.Errorw("failed to backup because open file error", "name", b.Name, "id", b.ID)
-			continue
-		}
-		uploadProc := func() error {
-			defer f.Close()
-
-			// Create request body
-			var requestBody bytes.Buffer
-			writer := multipart.NewWriter(&requestBody)
-			writer.WriteField("chat_id", info.ChatID)
-			part, err := writer.CreateFormFile("document", path.Base(f.Name()))
-			if err != nil {
-				logger.Main.Errorw("failed to backup because create form file error", "name", b.Name, "id", b.ID)
-				return err
-			}
-			_, err = io.Copy(part, f)
-			if err != nil {
-				logger.Main.Errorw("failed to backup because copy file error", "name", b.Name, "id", b.ID)
-				return err
-			}
-			writer.Close()
-
-			// Create the HTTP POST request
-			url := fmt.Sprintf("https://api.telegram.org/bot%s/sendDocument", info.Token)
-			request, err := http.NewRequest("POST", url, &requestBody)
-			if err != nil {
-				logger.Main.Errorw("failed to backup because create request error", "name", b.Name, "id", b.ID)
-				return err
-			}
-			// Set the Content-Type header
-			request.Header.Set("Content-Type", writer.FormDataContentType())
-
-			logger.TgBot.Debugw("telegram bot upload start", "name", b.Name, "id", b.ID, "file", file.Name())
-
-			// Perform the HTTP request
-			client := &http.Client{}
-			response, err := client.Do(request)
-			if err != nil {
-				logger.Main.Errorw("failed to backup because send request error", "name", b.Name, "id", b.ID)
-				return err
-			}
-			defer response.Body.Close()
-			// body to string
-			body, _ := io.ReadAll(response.Body)
-
-			if response.StatusCode != 200 {
-				logger.TgBot.Errorw("failed to backup because telegram bot error", "name", b.Name, "id", b.ID, "status", response.Status, "body", body)
-			} else {
-				info2, _ := f.Stat()
-				b.Destination.Result.TotalUploadedFiles++
-				b.Destination.Result.TotalUploadedSize += info2.Size()
-				logger.TgBot.Debugw("telegram bot upload success", "name", b.Name, "id", b.ID, "file", file.Name(), "size", info2.Size())
-			}
-			return nil
-		}
-		_ = uploadProc()
+	// Create the HTTP POST request
+	url := telegramAPIURL(info.APIURL, info.Token, "sendDocument")
+	request, err := http.NewRequest("POST", url, &requestBody)
+	if err != nil {
+		logger.Main.Errorw("failed to backup because create request error", "name", b.Name, "id", b.ID)
+		return telegramError(err)
 	}
+	// Set the Content-Type header
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	logger.TgBot.Debugw("telegram bot upload start", "name", b.Name, "id", b.ID, "file", path.Base(localPath))
+
+	// Perform the HTTP request
+	client := &http.Client{}
+	response, err := client.Do(request)
+	if err != nil {
+		logger.Main.Errorw("failed to backup because send request error", "name", b.Name, "id", b.ID)
+		return telegramError(err)
+	}
+	defer response.Body.Close()
+	// body to string
+	body, _ := io.ReadAll(response.Body)
+
+	if response.StatusCode != 200 {
+		logger.TgBot.Errorw("failed to backup because telegram bot error", "name", b.Name, "id", b.ID, "status", response.Status, "body", body)
+		return fmt.Errorf("telegram bot error: %s", response.Status)
+	}
+
+	// Keep the size reported by Telegram for verification, the file is left
+	// unverified without one (a retry would post the file to the chat again)
+	var sendDocumentResponse telegramSendDocumentResponse
+	if json.Unmarshal(body, &sendDocumentResponse) == nil && sendDocumentResponse.Ok && sendDocumentResponse.Result.Document.FileSize != nil {
+		d.sizes[remoteName] = *sendDocumentResponse.Result.Document.FileSize
+	}
+	logger.TgBot.Debugw("telegram bot upload success", "name", b.Name, "id", b.ID, "file", path.Base(localPath))
+	return nil
+}
+
+// telegramError removes the request URL, which contains the bot token, from
+// errors of the HTTP client. The errors end up in the history and the dashboard.
+func telegramError(err error) error {
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("telegram request failed: %w", urlErr.Err)
+	}
+	return err
+}
+
+func (d *destinationTelegramBot) RemoteSize(remoteName string) (int64, error) {
+	size, ok := d.sizes[remoteName]
+	if !ok {
+		return 0, ErrVerifyNotSupported
+	}
+	return size, nil
+}
 
+func (d *destinationTelegramBot) Disconnect() error {
 	return nil
 }
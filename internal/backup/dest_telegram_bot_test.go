@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDestinationTelegramSize(t *testing.T) {
+	response := `{"ok":true,"result":{"document":{"file_size":4}}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot"+testTelegramToken+"/sendDocument" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		io.WriteString(w, response)
+	}))
+	defer server.Close()
+
+	localPath := filepath.Join(t.TempDir(), "dump.sql")
+	writeTestFile(t, localPath, "dump")
+	d, err := newDestination(DestinationInfo{Type: "telegram_bot", Info: DestinationTelegramInfo{Token: testTelegramToken, ChatID: "42", APIURL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Backup{Name: "db"}
+
+	err = d.Upload(b, localPath, "dump-1.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := d.(SizeVerifier).RemoteSize("dump-1.sql")
+	if err != nil || size != 4 {
+		t.Errorf("size = %d, %v, want 4", size, err)
+	}
+
+	// Without a size the file is unverified, a retry would post it again
+	response = `{"ok":true,"result":{"document":{}}}`
+	err = d.Upload(b, localPath, "dump-2.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.(SizeVerifier).RemoteSize("dump-2.sql")
+	if !errors.Is(err, ErrVerifyNotSupported) {
+		t.Errorf("error = %v, want ErrVerifyNotSupported", err)
+	}
+}
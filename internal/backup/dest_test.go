@@ -0,0 +1,217 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/xacnio/backupper/internal/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDestination keeps the uploaded files in memory. The first failUploads
+// uploads fail and the first badSizes/badHashes checks report a wrong copy.
+type fakeDestination struct {
+	failUploads int
+	badSizes    int
+	badHashes   int
+	sizeErr     error
+	hashErr     error
+
+	uploads []string
+	files   map[string]string
+}
+
+// testFakeDestination is the destination returned for the "fake" type.
+var testFakeDestination *fakeDestination
+
+func init() {
+	RegisterDestination("fake", func(info interface{}) (Destination, error) {
+		return testFakeDestination, nil
+	})
+}
+
+func (d *fakeDestination) Connect(b *Backup) error {
+	return nil
+}
+
+func (d *fakeDestination) Upload(b *Backup, localPath string, remoteName string) error {
+	d.uploads = append(d.uploads, remoteName)
+	if len(d.uploads) <= d.failUploads {
+		return errors.New("connection reset")
+	}
+	if d.files == nil {
+		d.files = make(map[string]string)
+	}
+	d.files[remoteName] = localPath
+	return nil
+}
+
+func (d *fakeDestination) Disconnect() error {
+	return nil
+}
+
+func (d *fakeDestination) RemoteSize(remoteName string) (int64, error) {
+	if d.sizeErr != nil {
+		return 0, d.sizeErr
+	}
+	info, err := os.Stat(d.files[remoteName])
+	if err != nil {
+		return 0, err
+	}
+	if d.badSizes > 0 {
+		d.badSizes--
+		return info.Size() + 1, nil
+	}
+	return info.Size(), nil
+}
+
+func (d *fakeDestination) RemoteSHA256(remoteName string) (string, error) {
+	if d.hashErr != nil {
+		return "", d.hashErr
+	}
+	hash, _, err := utils.FileSHA256(d.files[remoteName])
+	if d.badHashes > 0 {
+		d.badHashes--
+		return strings.Repeat("0", len(hash)), err
+	}
+	return hash, err
+}
+
+func TestUploadFile(t *testing.T) {
+	uploadRetryDelay = 0
+	defer func() { uploadRetryDelay = 2 * time.Second }()
+
+	localPath := filepath.Join(t.TempDir(), "dump.sql")
+	writeTestFile(t, localPath, "dump")
+	zero := 0
+
+	tests := []struct {
+		name     string
+		dest     fakeDestination
+		verify   string
+		retries  *int
+		err      string
+		uploads  int
+		verified int64
+	}{
+		{name: "verified", uploads: 1, verified: 1},
+		{name: "upload retried", dest: fakeDestination{failUploads: 1}, uploads: 2, verified: 1},
+		{name: "upload failed", dest: fakeDestination{failUploads: 5}, err: "connection reset", uploads: 3},
+		{name: "no retries", dest: fakeDestination{failUploads: 5}, retries: &zero, err: "connection reset", uploads: 1},
+		{name: "size mismatch retried", dest: fakeDestination{badSizes: 1}, uploads: 2, verified: 1},
+		{name: "size mismatch", dest: fakeDestination{badSizes: 5}, err: "size mismatch", uploads: 3},
+		{name: "size error", dest: fakeDestination{sizeErr: errors.New("550 file unavailable")}, err: "550 file unavailable", uploads: 3},
+		{name: "size not supported", dest: fakeDestination{sizeErr: ErrVerifyNotSupported}, uploads: 1},
+		{name: "hash mismatch retried", dest: fakeDestination{badHashes: 1}, verify: VerifyHash, uploads: 2, verified: 1},
+		{name: "hash mismatch", dest: fakeDestination{badHashes: 5}, verify: VerifyHash, err: "sha256 mismatch", uploads: 3},
+		{name: "hash not supported", dest: fakeDestination{hashErr: ErrVerifyNotSupported}, verify: VerifyHash, uploads: 1, verified: 1},
+		{name: "hash ignored", dest: fakeDestination{badHashes: 5}, verify: VerifySize, uploads: 1, verified: 1},
+		{name: "verify none", dest: fakeDestination{badSizes: 5}, verify: VerifyNone, uploads: 1},
+		{name: "unknown verify mode", verify: "crc", err: "unknown verify mode", uploads: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := test.dest
+			dest := &DestinationInfo{Type: "fake", Verify: test.verify, Retries: test.retries}
+			err := (&Backup{Name: "db"}).uploadFile(&d, dest, localPath, "dump.sql", 4)
+			if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("error = %v, want %q", err, test.err)
+			}
+			if len(d.uploads) != test.uploads {
+				t.Errorf("uploads = %d, want %d", len(d.uploads), test.uploads)
+			}
+			if dest.Result.TotalRetries != int64(test.uploads-1) {
+				t.Errorf("retries = %d, want %d", dest.Result.TotalRetries, test.uploads-1)
+			}
+			if dest.Result.TotalVerifiedFiles != test.verified {
+				t.Errorf("verified = %d, want %d", dest.Result.TotalVerifiedFiles, test.verified)
+			}
+		})
+	}
+}
+
+func TestUploadToFailedFiles(t *testing.T) {
+	uploadRetryDelay = 0
+	defer func() { uploadRetryDelay = 2 * time.Second }()
+
+	b := &Backup{Name: "db", ID: 1, StartedAt: time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC)}
+	writeTestFile(t, filepath.Join(b.tmpDir(), "dump.sql"), "dump")
+	defer b.clear()
+
+	// The remote copy is wrong after every upload
+	testFakeDestination = &fakeDestination{badSizes: 5}
+	dest := &DestinationInfo{Type: "fake"}
+	err := b.uploadTo(dest)
+	if err == nil || !strings.Contains(err.Error(), "size mismatch") {
+		t.Errorf("error = %v, want a size mismatch", err)
+	}
+	if strings.Join(dest.Result.FailedFiles, ",") != "dump.sql" || dest.Result.TotalRetries != 2 || dest.Result.TotalUploadedFiles != 0 {
+		t.Errorf("result = %+v", dest.Result)
+	}
+	if want := "dump-2023-07-20__10-30-00.sql"; len(testFakeDestination.uploads) != 3 || testFakeDestination.uploads[0] != want {
+		t.Errorf("uploads = %q, want %q 3 times", testFakeDestination.uploads, want)
+	}
+}
+
+func TestRunDestinationQuorum(t *testing.T) {
+	b := &Backup{Name: "db", ID: 2, StartedAt: time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC)}
+	writeTestFile(t, filepath.Join(b.tmpDir(), "dump.sql"), "dump")
+	defer b.clear()
+	noRetries := 0
+
+	tests := []struct {
+		name   string
+		quorum *int
+		err    string
+	}{
+		{name: "all destinations", err: "1 of 2 destinations succeeded (quorum 2)"},
+		{name: "quorum", quorum: intPtr(1)},
+		{name: "quorum above the count", quorum: intPtr(3), err: "1 of 2 destinations succeeded (quorum 2)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testFakeDestination = &fakeDestination{failUploads: 1}
+			b.DestinationQuorum = test.quorum
+			b.Destinations = []DestinationInfo{
+				{Type: "local", Info: DestinationLocalInfo{Target: t.TempDir()}},
+				{Name: "offsite", Type: "fake", Retries: &noRetries},
+			}
+			err := b.runDestination()
+			if (err == nil) != (test.err == "") || (err != nil && err.Error() != test.err) {
+				t.Errorf("error = %v, want %q", err, test.err)
+			}
+
+			local, offsite := b.Destinations[0].Result, b.Destinations[1].Result
+			if !local.Success || local.TotalUploadedFiles != 1 || local.Error != "" {
+				t.Errorf("local result = %+v", local)
+			}
+			if offsite.Success || offsite.Error != "connection reset" || strings.Join(offsite.FailedFiles, ",") != "dump.sql" {
+				t.Errorf("offsite result = %+v", offsite)
+			}
+		})
+	}
+
+	// The callback has the result of every destination
+	data, err := json.Marshal(b.callbackData(CallbackSuccess, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Destinations []struct {
+			Name   string            `json:"name"`
+			Type   string            `json:"type"`
+			Result DestinationResult `json:"result"`
+		} `json:"backup_destinations"`
+	}
+	err = json.Unmarshal(data, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dests := payload.Destinations
+	if len(dests) != 2 || dests[0].Name != "local" || !dests[0].Result.Success || dests[1].Name != "offsite" || dests[1].Type != "fake" || dests[1].Result.Error != "connection reset" {
+		t.Errorf("backup_destinations = %+v", dests)
+	}
+}
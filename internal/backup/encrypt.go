@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/crypt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type EncryptionInfo struct {
+	Format         string   `json:"format"`
+	Recipients     []string `json:"recipients"`
+	RecipientFiles []string `json:"recipientFiles"`
+}
+
+// runEncryption replaces every file in ./tmp/{id}/ with its encrypted version.
+func (b *Backup) runEncryption() error {
+	info := *b.Encryption
+	if info.Format == "" {
+		info.Format = crypt.FormatAge
+	}
+
+	encrypter, err := crypt.NewEncrypter(info.Format, info.Recipients, info.RecipientFiles)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(b.tmpDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		encryptedPath := p + crypt.Extension(info.Format)
+		err = encrypter.EncryptFile(p, encryptedPath)
+		if err != nil {
+			os.Remove(encryptedPath)
+			return err
+		}
+		logger.Main.Debugw("file encrypted", "name", b.Name, "id", b.ID, "file", encryptedPath)
+		return os.Remove(p)
+	})
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"filippo.io/age"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	writeTestFile(t, identityFile, identity.String()+"\n")
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFile := filepath.Join(t.TempDir(), "other.txt")
+	writeTestFile(t, otherFile, other.String()+"\n")
+
+	src := t.TempDir()
+	target := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "db.sql"), "dump")
+	b := &Backup{
+		Name:        "encrypted",
+		Source:      SourceInfo{Type: "local", Info: SourceLocalInfo{Paths: []string{filepath.Join(src, "db.sql")}}},
+		Destination: DestinationInfo{Type: "local", Info: DestinationLocalInfo{Target: target}},
+		Encryption:  &EncryptionInfo{Recipients: []string{identity.Recipient().String()}},
+	}
+	b.CreateFunc()()
+	if !b.Destination.Result.Success {
+		t.Fatalf("run failed: %s", b.Destination.Result.Error)
+	}
+
+	// Every uploaded file is encrypted, the manifest lists their checksums
+	for _, name := range readTestDir(t, target) {
+		if !strings.HasSuffix(name, ".age") && !strings.HasPrefix(name, "manifest-") {
+			t.Errorf("uploaded %s without encryption", name)
+		}
+	}
+
+	_, err = b.Restore(RestoreOptions{To: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "identity") {
+		t.Errorf("restore without identity: %v", err)
+	}
+	_, err = b.Restore(RestoreOptions{To: t.TempDir(), Identity: otherFile})
+	if err == nil {
+		t.Error("restore with another identity didn't fail")
+	}
+
+	to := t.TempDir()
+	_, err = b.Restore(RestoreOptions{To: to, Identity: identityFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestDir(t, to); strings.Join(got, ",") != "db.sql" {
+		t.Errorf("restored %q, want db.sql", got)
+	}
+	data, err := os.ReadFile(filepath.Join(to, "db.sql"))
+	if err != nil || string(data) != "dump" {
+		t.Errorf("db.sql = %q, %v", data, err)
+	}
+}
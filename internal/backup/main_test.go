@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+	"time"
+)
+
+const testDateFormat = "2006-01-02__15-04-05"
+
+// TestMain runs the tests in a temporary directory, the runs write ./tmp/ and the history there.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "backupper-test-*")
+	if err != nil {
+		panic(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	config.Set(&config.Config{DateFormat: testDateFormat})
+	utils.TimeLocation = time.UTC
+	nop := zap.NewNop().Sugar()
+	logger.Main, logger.SSH, logger.SFTP, logger.FTP, logger.TgBot, logger.Local, logger.S3 = nop, nop, nop, nop, nop, nop, nop
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// waitNextSecond sleeps until the next second, runs in the same second would get the same file names.
+func waitNextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const manifestFileName = "manifest.json"
+
+type ManifestSource struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Folder string `json:"folder,omitempty"`
+}
+
+type ManifestFile struct {
+	Name       string `json:"name"`
+	RemoteName string `json:"remoteName"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+type Manifest struct {
+	BackupID   string           `json:"backupId"`
+	BackupName string           `json:"backupName"`
+	BackupDate string           `json:"backupDate"`
+	Sources    []ManifestSource `json:"sources"`
+	Archive    string           `json:"archive,omitempty"`
+	Encryption string           `json:"encryption,omitempty"`
+	Files      []ManifestFile   `json:"files"`
+}
+
+// manifestEnabled reports whether a manifest is uploaded, it is on unless "manifest" is false.
+func (b *Backup) manifestEnabled() bool {
+	return b.Manifest == nil || *b.Manifest
+}
+
+// runManifest hashes every file in ./tmp/{id}/ and writes the result to
+// ./tmp/{id}/manifest.json, which is uploaded as manifest-<date>.json.
+func (b *Backup) runManifest() error {
+	tmpDir := b.tmpDir()
+	if _, err := os.Stat(tmpDir + manifestFileName); err == nil {
+		return fmt.Errorf("%s already exists in backup files", manifestFileName)
+	}
+
+	manifest := Manifest{
+		BackupID:   b.stringID(),
+		BackupName: b.Name,
+		BackupDate: b.StartedAt.Format(time.RFC3339),
+		Files:      []ManifestFile{},
+	}
+	for _, src := range b.sources() {
+		manifest.Sources = append(manifest.Sources, ManifestSource{
+			Name:   src.displayName(),
+			Type:   src.Type,
+			Folder: src.Folder,
+		})
+	}
+	if b.Archive != nil {
+		manifest.Archive = b.Archive.Format
+	}
+	if b.Encryption != nil {
+		manifest.Encryption = b.Encryption.Format
+	}
+
+	err := filepath.WalkDir(tmpDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(tmpDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		hash, size, err := utils.FileSHA256(p)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:       relPath,
+			RemoteName: b.remoteFileName(relPath),
+			Size:       size,
+			SHA256:     hash,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Name < manifest.Files[j].Name
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(tmpDir+manifestFileName, data, 0666)
+}
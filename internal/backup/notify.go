@@ -0,0 +1,269 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotifyOnSuccess = "success"
+	NotifyOnFailure = "failure"
+	// NotifyOnChange sends when the status differs from the previous run, e.g. failed -> recovered.
+	NotifyOnChange = "change"
+)
+
+var defaultNotifyOn = []string{NotifyOnFailure, NotifyOnChange}
+
+type NotificationInfo struct {
+	Name string   `json:"name"`
+	Type string   `json:"type"`
+	On   []string `json:"on"`
+	// DigestCronExpression sends a digest of the runs since the previous one
+	// on its schedule, instead of a notification after each run.
+	DigestCronExpression string      `json:"digestCronExpr"`
+	Info                 interface{} `json:"info"`
+}
+
+// Notification is a finished backup run sent to the notifiers.
+type Notification struct {
+	Backup   *Backup
+	Run      history.Run
+	Previous *history.Run
+}
+
+// Notifier sends a notification about a finished backup run.
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// DigestNotifier is implemented by notifiers which can send a digest of many runs.
+type DigestNotifier interface {
+	NotifyDigest(d *Digest) error
+}
+
+// Digest is the runs of the jobs in a period, sent on "digestCronExpr".
+type Digest struct {
+	From time.Time
+	To   time.Time
+	Jobs []DigestJob
+}
+
+type DigestJob struct {
+	Name string
+	// Runs are the backup and prune runs, oldest first.
+	Runs []history.Run
+}
+
+// NotifierFactory builds a Notifier from the raw "info" object of the config.
+type NotifierFactory func(info interface{}) (Notifier, error)
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   = make(map[string]NotifierFactory)
+)
+
+// RegisterNotifier makes a notifier type available to the "type" field of a notification.
+func RegisterNotifier(notifierType string, factory NotifierFactory) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	if factory == nil {
+		panic("backup: RegisterNotifier factory is nil")
+	}
+	if _, dup := notifiers[notifierType]; dup {
+		panic("backup: RegisterNotifier called twice for type " + notifierType)
+	}
+	notifiers[notifierType] = factory
+}
+
+func newNotifier(info NotificationInfo) (Notifier, error) {
+	notifiersMu.RLock()
+	factory, ok := notifiers[info.Type]
+	notifiersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier type: %q", info.Type)
+	}
+	return factory(info.Info)
+}
+
+func (info *NotificationInfo) displayName() string {
+	if info.Name != "" {
+		return info.Name
+	}
+	return info.Type
+}
+
+// wants reports whether the notification is sent for the run.
+func (info *NotificationInfo) wants(run *history.Run, previous *history.Run) bool {
+	on := info.On
+	if len(on) == 0 {
+		on = defaultNotifyOn
+	}
+	for _, event := range on {
+		switch event {
+		case NotifyOnSuccess:
+			if run.Success {
+				return true
+			}
+		case NotifyOnFailure:
+			if !run.Success {
+				return true
+			}
+		case NotifyOnChange:
+			if previous != nil && previous.Success != run.Success {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// notifications returns the notifications of the backup, or the global ones
+// of the config if the backup has none.
+func (b *Backup) notifications() []NotificationInfo {
+	if b.Notifications != nil {
+		return b.Notifications
+	}
+	return GlobalNotifications()
+}
+
+// notify sends the finished run to the notifications which want it.
+func (b *Backup) notify(run *history.Run, previous *history.Run) {
+	n := &Notification{
+		Backup:   b,
+		Run:      *run,
+		Previous: previous,
+	}
+
+	started := time.Now()
+	sent := 0
+	var errs []string
+	for _, info := range b.notifications() {
+		if info.DigestCronExpression != "" || !info.wants(run, previous) {
+			continue
+		}
+		sent++
+		notifier, err := newNotifier(info)
+		if err == nil {
+			err = notifier.Notify(n)
+		}
+		if err != nil {
+			errs = append(errs, info.displayName()+": "+err.Error())
+			logger.Main.Errorw("notification error", "name", b.Name, "id", b.ID, "notification", info.displayName(), "error", err)
+		} else {
+			logger.Main.Debugw("notification sent", "name", b.Name, "id", b.ID, "notification", info.displayName())
+		}
+	}
+	if sent == 0 {
+		return
+	}
+	var err error
+	if len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "; "))
+	}
+	run.AddStage("notify", started, err)
+}
+
+// Status is "success", "failed" or "recovered" if the previous run failed.
+func (n *Notification) Status() string {
+	if !n.Run.Success {
+		return "failed"
+	}
+	if n.Previous != nil && !n.Previous.Success {
+		return "recovered"
+	}
+	return "success"
+}
+
+// Title is the status as a sentence, e.g. "Backup recovered".
+func (n *Notification) Title() string {
+	titles := map[string]string{
+		"success":   "Backup succeeded",
+		"failed":    "Backup failed",
+		"recovered": "Backup recovered",
+	}
+	return titles[n.Status()]
+}
+
+// Data returns the callback payload of the run with "backup_title" and
+// "recovered" as "backup_status", decoded like JSON for templates.
+func (n *Notification) Data() map[string]interface{} {
+	status := CallbackSuccess
+	if !n.Run.Success {
+		status = CallbackFailed
+	}
+	data := n.Backup.callbackData(status, n.Run.Error)
+	data["backup_duration"] = n.Run.Duration().String()
+	data["backup_status"] = n.Status()
+	data["backup_title"] = n.Title()
+	return jsonData(data)
+}
+
+// Lines returns the summary of the run as "key: value" lines, without the status.
+func (n *Notification) Lines() []string {
+	run := n.Run
+	lines := []string{
+		"Job: " + run.Job,
+		"Started: " + run.StartedAt.In(utils.TimeLocation).Format("2006-01-02 15:04:05"),
+		"Duration: " + run.Duration().Round(time.Millisecond).String(),
+		fmt.Sprintf("Files: %d (%s)", run.Files, utils.FormatSize(run.Bytes)),
+	}
+	if run.Deleted > 0 {
+		lines = append(lines, fmt.Sprintf("Deleted by retention: %d", run.Deleted))
+	}
+	for _, dest := range run.Destinations {
+		if dest.Error != "" {
+			lines = append(lines, fmt.Sprintf("Destination %s: %s", dest.Name, dest.Error))
+		}
+	}
+	if run.Error != "" {
+		lines = append(lines, "Error: "+run.Error)
+	}
+	return lines
+}
+
+// CreateDigestFunc returns a function which sends the runs of the jobs since
+// its previous call (or of the last day) to the notification.
+func CreateDigestFunc(info NotificationInfo, jobs []string) func() {
+	from := time.Now().Add(-24 * time.Hour)
+	return func() {
+		digest := &Digest{From: from, To: time.Now()}
+		for _, job := range jobs {
+			runs, err := history.Between(job, digest.From, digest.To)
+			if err != nil {
+				logger.Main.Errorw("digest error", "notification", info.displayName(), "name", job, "error", err)
+				return
+			}
+			digest.Jobs = append(digest.Jobs, DigestJob{Name: job, Runs: runs})
+		}
+
+		notifier, err := newNotifier(info)
+		if err != nil {
+			logger.Main.Errorw("digest error", "notification", info.displayName(), "error", err)
+			return
+		}
+		digestNotifier, ok := notifier.(DigestNotifier)
+		if !ok {
+			logger.Main.Errorw("digest error", "notification", info.displayName(), "error", fmt.Sprintf("notifier type %q can't send digests", info.Type))
+			return
+		}
+		err = digestNotifier.NotifyDigest(digest)
+		if err != nil {
+			logger.Main.Errorw("digest error", "notification", info.displayName(), "error", err)
+			return
+		}
+		from = digest.To
+		logger.Main.Infow("digest sent", "notification", info.displayName(), "jobs", len(jobs))
+	}
+}
+
+// GlobalNotifications returns the notifications of the main config.
+func GlobalNotifications() []NotificationInfo {
+	return utils.ConvertToStruct[[]NotificationInfo](config.Get().Notifications)
+}
@@ -0,0 +1,272 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EmailSecurityStartTLS = "starttls"
+	EmailSecurityTLS      = "tls"
+	EmailSecurityNone     = "none"
+)
+
+const emailTimeout = 30 * time.Second
+
+type NotifierEmailInfo struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	User string `json:"user"`
+	Pass string `json:"pass"`
+	From string `json:"from"`
+	// To is the list of recipients.
+	To []string `json:"to"`
+	// Security is "starttls" (default), "tls" (implicit TLS, e.g. port 465) or "none".
+	Security           string `json:"security"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	SubjectPrefix      string `json:"subjectPrefix"`
+}
+
+type notifierEmail struct {
+	info NotifierEmailInfo
+}
+
+func init() {
+	RegisterNotifier("email", func(info interface{}) (Notifier, error) {
+		return &notifierEmail{
+			info: utils.ConvertToStruct[NotifierEmailInfo](info),
+		}, nil
+	})
+}
+
+func (n *notifierEmail) Notify(notification *Notification) error {
+	run := notification.Run
+	subject := fmt.Sprintf("%s: %s", run.Job, notification.Title())
+
+	var body strings.Builder
+	for _, line := range notification.Lines() {
+		body.WriteString(line + "\n")
+	}
+	writeRunDetails(&body, run)
+	return n.send(subject, body.String())
+}
+
+func (n *notifierEmail) NotifyDigest(digest *Digest) error {
+	failed := 0
+	var body strings.Builder
+	fmt.Fprintf(&body, "Backup runs from %s to %s\n", formatDigestTime(digest.From), formatDigestTime(digest.To))
+
+	for _, job := range digest.Jobs {
+		var succeeded, failures, files, deleted int
+		var size int64
+		for _, run := range job.Runs {
+			if run.Success {
+				succeeded++
+			} else {
+				failures++
+			}
+			files += int(run.Files)
+			size += run.Bytes
+			deleted += run.Deleted
+		}
+		if failures > 0 {
+			failed++
+		}
+
+		status := "OK"
+		if len(job.Runs) == 0 {
+			status = "NO RUNS"
+		} else if failures > 0 {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&body, "\n== %s: %s ==\n", job.Name, status)
+		fmt.Fprintf(&body, "Runs: %d (%d succeeded, %d failed)\n", len(job.Runs), succeeded, failures)
+		fmt.Fprintf(&body, "Uploaded: %d files (%s)\n", files, utils.FormatSize(size))
+		fmt.Fprintf(&body, "Deleted by retention: %d\n", deleted)
+		for _, run := range job.Runs {
+			if run.Success && run.Deleted == 0 && !hasWarnings(run) {
+				continue
+			}
+			fmt.Fprintf(&body, "\n%s %s run at %s\n", strings.ToUpper(runStatus(run)), run.Kind, formatDigestTime(run.StartedAt))
+			if run.Error != "" {
+				body.WriteString("Error: " + run.Error + "\n")
+			}
+			writeRunDetails(&body, run)
+		}
+	}
+
+	subject := fmt.Sprintf("backup report: %d jobs, %d failed", len(digest.Jobs), failed)
+	return n.send(subject, body.String())
+}
+
+// writeRunDetails writes the destination errors, warnings and the files deleted by retention.
+func writeRunDetails(body *strings.Builder, run history.Run) {
+	for _, dest := range run.Destinations {
+		for _, warning := range dest.Warnings {
+			fmt.Fprintf(body, "Destination %s warning: %s\n", dest.Name, warning)
+		}
+		if len(dest.Deleted) > 0 {
+			fmt.Fprintf(body, "Deleted from %s:\n", dest.Name)
+			for _, file := range dest.Deleted {
+				body.WriteString("  " + file + "\n")
+			}
+		}
+	}
+}
+
+func hasWarnings(run history.Run) bool {
+	for _, dest := range run.Destinations {
+		if len(dest.Warnings) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func runStatus(run history.Run) string {
+	if run.Success {
+		return "success"
+	}
+	return "failed"
+}
+
+func formatDigestTime(t time.Time) string {
+	return t.In(utils.TimeLocation).Format("2006-01-02 15:04:05")
+}
+
+// message builds a plain text mail with a quoted-printable body.
+func (n *notifierEmail) message(subject string, body string) ([]byte, error) {
+	if n.info.SubjectPrefix != "" {
+		subject = n.info.SubjectPrefix + " " + subject
+	}
+	hostname, _ := os.Hostname()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.info.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.info.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%d.backupper@%s>\r\n", time.Now().UnixNano(), hostname)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&msg)
+	_, err := w.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func (n *notifierEmail) send(subject string, body string) error {
+	info := n.info
+	if info.Host == "" || info.From == "" || len(info.To) == 0 {
+		return errors.New("email host, from and to are required")
+	}
+	security := info.Security
+	if security == "" {
+		security = EmailSecurityStartTLS
+	}
+	port := info.Port
+	if port == 0 {
+		port = 587
+		if security == EmailSecurityTLS {
+			port = 465
+		}
+	}
+
+	msg, err := n.message(subject, body)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(info.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: info.Host, InsecureSkipVerify: info.InsecureSkipVerify}
+	var conn net.Conn
+	switch security {
+	case EmailSecurityTLS:
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: emailTimeout}, "tcp", addr, tlsConfig)
+	case EmailSecurityStartTLS, EmailSecurityNone:
+		conn, err = net.DialTimeout("tcp", addr, emailTimeout)
+	default:
+		return fmt.Errorf("unknown email security: %q", security)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	c, err := smtp.NewClient(conn, info.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if security == EmailSecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server doesn't support STARTTLS")
+		}
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if info.User != "" {
+		err = c.Auth(smtp.PlainAuth("", info.User, info.Pass, info.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The envelope takes bare addresses, the headers keep the display names
+	from, err := mail.ParseAddress(info.From)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	err = c.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	for _, to := range info.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("to: %w", err)
+		}
+		err = c.Rcpt(addr.Address)
+		if err != nil {
+			return fmt.Errorf("%s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
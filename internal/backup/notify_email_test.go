@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"bufio"
+	"github.com/xacnio/backupper/internal/history"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMail struct {
+	from string
+	to   []string
+	msg  *mail.Message
+	body string
+}
+
+// testSMTPServer accepts plain SMTP sessions on a random local port and sends
+// the received mails to the channel.
+func testSMTPServer(t *testing.T) (string, int, <-chan testMail) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	mails := make(chan testMail, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSMTP(conn, mails)
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, mails
+}
+
+func serveTestSMTP(conn net.Conn, mails chan<- testMail) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 localhost ESMTP")
+	var m testMail
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			c.PrintfLine("250 localhost")
+		case "MAIL":
+			m.from = strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.msg, err = mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+			if err != nil {
+				return
+			}
+			body, _ := io.ReadAll(quotedprintable.NewReader(m.msg.Body))
+			m.body = string(body)
+			mails <- m
+			m = testMail{}
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func receiveTestMail(t *testing.T, mails <-chan testMail) testMail {
+	t.Helper()
+	select {
+	case m := <-mails:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+		return testMail{}
+	}
+}
+
+func TestNotifierEmail(t *testing.T) {
+	host, port, mails := testSMTPServer(t)
+	n := &notifierEmail{info: NotifierEmailInfo{
+		Host:          host,
+		Port:          port,
+		From:          "Backupper <backup@example.com>",
+		To:            []string{"ops@example.com", "Admin <admin@example.com>"},
+		Security:      EmailSecurityNone,
+		SubjectPrefix: "[prod]",
+	}}
+
+	notification := testNotification(false, nil)
+	notification.Run.Destinations = []history.Destination{
+		{Name: "s3", Warnings: []string{"size mismatch"}, Deleted: []string{"dump-2023-07-19__10-30-00.sql"}},
+	}
+	err := n.Notify(notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := receiveTestMail(t, mails)
+	if m.from != "backup@example.com" || strings.Join(m.to, ",") != "ops@example.com,admin@example.com" {
+		t.Errorf("envelope = %q, %q", m.from, m.to)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(m.msg.Header.Get("Subject"))
+	if subject != "[prod] db: Backup failed" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{"Job: db\n", "Error: connection refused\n", "Destination s3 warning: size mismatch\n", "Deleted from s3:\n  dump-2023-07-19__10-30-00.sql\n"} {
+		if !strings.Contains(m.body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, m.body)
+		}
+	}
+}
+
+func TestNotifierEmailDigest(t *testing.T) {
+	host, port, mails := testSMTPServer(t)
+	n := &notifierEmail{info: NotifierEmailInfo{Host: host, Port: port, From: "backup@example.com", To: []string{"ops@example.com"}, Security: EmailSecurityNone}}
+
+	from := time.Date(2023, 7, 20, 0, 0, 0, 0, time.UTC)
+	err := n.NotifyDigest(&Digest{
+		From: from,
+		To:   from.Add(24 * time.Hour),
+		Jobs: []DigestJob{
+			{Name: "db", Runs: []history.Run{
+				{Kind: history.KindBackup, StartedAt: from.Add(time.Hour), Success: true, Files: 2, Bytes: 1024},
+				{Kind: history.KindBackup, StartedAt: from.Add(2 * time.Hour), Success: false, Error: "timeout"},
+			}},
+			{Name: "files"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := receiveTestMail(t, mails)
+	if subject := m.msg.Header.Get("Subject"); !strings.Contains(subject, "backup report: 2 jobs, 1 failed") {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{
+		"Backup runs from 2023-07-20 00:00:00 to 2023-07-21 00:00:00\n",
+		"== db: FAILED ==\nRuns: 2 (1 succeeded, 1 failed)\n",
+		"FAILED backup run at 2023-07-20 02:00:00\nError: timeout\n",
+		"== files: NO RUNS ==\n",
+	} {
+		if !strings.Contains(m.body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, m.body)
+		}
+	}
+}
+
+func TestNotifierEmailErrors(t *testing.T) {
+	host, port, _ := testSMTPServer(t)
+	tests := []struct {
+		info NotifierEmailInfo
+		want string
+	}{
+		{NotifierEmailInfo{Host: host, Port: port}, "required"},
+		{NotifierEmailInfo{Host: host, Port: port, From: "a@example.com", To: []string{"b@example.com"}, Security: "ssl"}, "unknown email security"},
+		{NotifierEmailInfo{Host: host, Port: port, From: "a@example.com", To: []string{"b@example.com"}}, "STARTTLS"},
+		{NotifierEmailInfo{Host: host, Port: port, From: "not an address", To: []string{"b@example.com"}, Security: EmailSecurityNone}, "from:"},
+	}
+	for _, test := range tests {
+		err := (&notifierEmail{info: test.info}).send("subject", "body")
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%+v: error = %v, want %q", test.info, err, test.want)
+		}
+	}
+}
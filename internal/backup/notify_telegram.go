@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+type NotifierTelegramInfo struct {
+	Token  string `json:"token"`
+	ChatID string `json:"chatID"`
+	// APIURL is the base URL of the Bot API, https://api.telegram.org by default.
+	APIURL string `json:"apiUrl"`
+}
+
+type notifierTelegram struct {
+	info NotifierTelegramInfo
+}
+
+type telegramResponse struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func init() {
+	RegisterNotifier("telegram", func(info interface{}) (Notifier, error) {
+		return &notifierTelegram{
+			info: utils.ConvertToStruct[NotifierTelegramInfo](info),
+		}, nil
+	})
+}
+
+// telegramAPIURL returns the URL of a Bot API method.
+func telegramAPIURL(apiURL string, token string, method string) string {
+	if apiURL == "" {
+		apiURL = defaultTelegramAPIURL
+	}
+	return fmt.Sprintf("%s/bot%s/%s", strings.TrimSuffix(apiURL, "/"), token, method)
+}
+
+// credentials returns the token and chat of the notifier, missing ones are
+// taken from the telegram_bot destination of the backup.
+func (n *notifierTelegram) credentials(b *Backup) (NotifierTelegramInfo, error) {
+	info := n.info
+	for _, dest := range b.destinations() {
+		if info.Token != "" && info.ChatID != "" {
+			break
+		}
+		if dest.Type != "telegram_bot" {
+			continue
+		}
+		destInfo := utils.ConvertToStruct[DestinationTelegramInfo](dest.Info)
+		if info.Token == "" {
+			info.Token = destInfo.Token
+		}
+		if info.ChatID == "" {
+			info.ChatID = destInfo.ChatID
+		}
+		if info.APIURL == "" {
+			info.APIURL = destInfo.APIURL
+		}
+	}
+	if info.Token == "" || info.ChatID == "" {
+		return info, fmt.Errorf("telegram token and chatID are required")
+	}
+	return info, nil
+}
+
+func (n *notifierTelegram) Notify(notification *Notification) error {
+	info, err := n.credentials(notification.Backup)
+	if err != nil {
+		return err
+	}
+
+	icons := map[string]string{"success": "✅", "failed": "❌", "recovered": "♻️"}
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s <b>%s</b>\n", icons[notification.Status()], notification.Title())
+	for _, line := range notification.Lines() {
+		text.WriteString(html.EscapeString(line) + "\n")
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"chat_id":                  info.ChatID,
+		"text":                     text.String(),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Post(telegramAPIURL(info.APIURL, info.Token, "sendMessage"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return telegramError(err)
+	}
+	defer response.Body.Close()
+
+	var result telegramResponse
+	data, _ := io.ReadAll(response.Body)
+	err = json.Unmarshal(data, &result)
+	if response.StatusCode != http.StatusOK || err != nil || !result.Ok {
+		if result.Description != "" {
+			return fmt.Errorf("telegram error: %s: %s", response.Status, result.Description)
+		}
+		return fmt.Errorf("telegram error: %s", response.Status)
+	}
+	return nil
+}
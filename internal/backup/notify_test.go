@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"encoding/json"
+	"github.com/xacnio/backupper/internal/history"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTelegramToken = "123456:secret-token"
+
+func testNotification(success bool, previous *history.Run) *Notification {
+	startedAt := time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC)
+	run := history.Run{
+		Job:        "db",
+		ID:         startedAt.UnixNano(),
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(3 * time.Second),
+		Success:    success,
+		Files:      2,
+		Bytes:      2048,
+	}
+	if !success {
+		run.Error = "connection refused"
+	}
+	return &Notification{
+		Backup:   &Backup{Name: "db", ID: run.ID, StartedAt: startedAt},
+		Run:      run,
+		Previous: previous,
+	}
+}
+
+func TestNotificationWants(t *testing.T) {
+	success := &history.Run{Success: true}
+	failed := &history.Run{Success: false}
+	tests := []struct {
+		on       []string
+		run      *history.Run
+		previous *history.Run
+		want     bool
+	}{
+		{nil, failed, nil, true},
+		{nil, success, nil, false},
+		{nil, success, success, false},
+		{nil, success, failed, true},
+		{[]string{NotifyOnSuccess}, success, nil, true},
+		{[]string{NotifyOnSuccess}, failed, nil, false},
+		{[]string{NotifyOnChange}, failed, success, true},
+		{[]string{NotifyOnChange}, failed, failed, false},
+	}
+	for i, test := range tests {
+		info := NotificationInfo{On: test.on}
+		if got := info.wants(test.run, test.previous); got != test.want {
+			t.Errorf("%d: wants = %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestNotificationStatus(t *testing.T) {
+	if got := testNotification(true, nil).Status(); got != "success" {
+		t.Errorf("status = %q, want success", got)
+	}
+	if got := testNotification(false, nil).Status(); got != "failed" {
+		t.Errorf("status = %q, want failed", got)
+	}
+	if got := testNotification(true, &history.Run{Success: false}).Title(); got != "Backup recovered" {
+		t.Errorf("title = %q, want Backup recovered", got)
+	}
+}
+
+func TestNotifierTelegram(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot"+testTelegramToken+"/sendMessage" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &request)
+		if request["chat_id"] == "404" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"ok":false,"description":"Bad Request: chat not found"}`)
+			return
+		}
+		io.WriteString(w, `{"ok":true}`)
+	}))
+	defer server.Close()
+
+	info := NotifierTelegramInfo{Token: testTelegramToken, ChatID: "42", APIURL: server.URL + "/"}
+	err := (&notifierTelegram{info: info}).Notify(testNotification(false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := request["text"].(string)
+	if request["chat_id"] != "42" || request["parse_mode"] != "HTML" || !strings.HasPrefix(text, "❌ <b>Backup failed</b>\n") || !strings.Contains(text, "Error: connection refused") {
+		t.Errorf("request = %v", request)
+	}
+
+	info.ChatID = "404"
+	err = (&notifierTelegram{info: info}).Notify(testNotification(false, nil))
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("error = %v, want the description", err)
+	}
+
+	// The URL of the request contains the token, it must not end up in the error
+	server.Close()
+	err = (&notifierTelegram{info: info}).Notify(testNotification(false, nil))
+	if err == nil || strings.Contains(err.Error(), testTelegramToken) {
+		t.Errorf("error = %v, want one without the token", err)
+	}
+}
+
+func TestNotifierTelegramCredentials(t *testing.T) {
+	b := &Backup{Destinations: []DestinationInfo{
+		{Type: "local"},
+		{Type: "telegram_bot", Info: DestinationTelegramInfo{Token: testTelegramToken, ChatID: "42", APIURL: "http://localhost"}},
+	}}
+	info, err := (&notifierTelegram{info: NotifierTelegramInfo{ChatID: "7"}}).credentials(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Token != testTelegramToken || info.ChatID != "7" || info.APIURL != "http://localhost" {
+		t.Errorf("credentials = %+v", info)
+	}
+
+	_, err = (&notifierTelegram{}).credentials(&Backup{})
+	if err == nil {
+		t.Error("credentials without a token didn't fail")
+	}
+}
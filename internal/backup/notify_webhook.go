@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultWebhookTemplate is the message of the chat webhooks, it has the
+// fields of the callback payload.
+const defaultWebhookTemplate = `{{.backup_title}}: {{.backup_name}}
+Duration: {{.backup_duration}}
+{{range .backup_destinations}}{{.name}}: {{if .result.success}}ok{{else}}failed{{end}}, {{.result.totalUploadedFiles}} files ({{size .result.totalUploadedSize}}){{with .result.error}}, {{.}}{{end}}
+{{end}}{{with .backup_error}}Error: {{.}}{{end}}`
+
+// discordMaxContent is the length limit of a Discord message.
+const discordMaxContent = 2000
+
+type NotifierWebhookInfo struct {
+	URL string `json:"url"`
+	// Template is the message text, a Go text/template of the callback payload.
+	Template string `json:"template"`
+	// Body replaces the whole JSON body, the rendered message is in .message.
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+}
+
+type notifierWebhook struct {
+	kind string
+	info NotifierWebhookInfo
+}
+
+func init() {
+	for _, kind := range []string{"slack", "discord", "teams"} {
+		kind := kind
+		RegisterNotifier(kind, func(info interface{}) (Notifier, error) {
+			return &notifierWebhook{
+				kind: kind,
+				info: utils.ConvertToStruct[NotifierWebhookInfo](info),
+			}, nil
+		})
+	}
+}
+
+var webhookFuncs = template.FuncMap{
+	"size": func(size interface{}) string {
+		n, _ := strconv.ParseInt(fmt.Sprint(size), 10, 64)
+		return utils.FormatSize(n)
+	},
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func renderWebhookTemplate(name string, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	err = tmpl.Execute(&out, data)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// body returns the JSON body of the webhook type for the message.
+func (n *notifierWebhook) body(notification *Notification, message string) ([]byte, error) {
+	switch n.kind {
+	case "slack":
+		return json.Marshal(map[string]interface{}{"text": message})
+	case "discord":
+		if runes := []rune(message); len(runes) > discordMaxContent {
+			message = string(runes[:discordMaxContent-3]) + "..."
+		}
+		return json.Marshal(map[string]interface{}{"content": message})
+	case "teams":
+		color := "2EB886"
+		if !notification.Run.Success {
+			color = "D00000"
+		}
+		return json.Marshal(map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    notification.Title() + ": " + notification.Run.Job,
+			"themeColor": color,
+			"title":      notification.Title() + ": " + notification.Run.Job,
+			// Teams needs blank lines for line breaks
+			"text": strings.ReplaceAll(message, "\n", "\n\n"),
+		})
+	}
+	return nil, fmt.Errorf("unknown webhook type: %q", n.kind)
+}
+
+func (n *notifierWebhook) Notify(notification *Notification) error {
+	if n.info.URL == "" {
+		return fmt.Errorf("%s webhook url is required", n.kind)
+	}
+
+	data := notification.Data()
+	text := n.info.Template
+	if text == "" {
+		text = defaultWebhookTemplate
+	}
+	message, err := renderWebhookTemplate("template", text, data)
+	if err != nil {
+		return err
+	}
+	message = strings.TrimSpace(message)
+
+	var body []byte
+	if n.info.Body != "" {
+		data["message"] = message
+		rendered, err := renderWebhookTemplate("body", n.info.Body, data)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	} else {
+		body, err = n.body(notification, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.info.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Backupper")
+	for key, value := range n.info.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s webhook error: %s: %s", n.kind, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
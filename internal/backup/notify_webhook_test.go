@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testRequest struct {
+	method string
+	header http.Header
+	body   []byte
+}
+
+// testHTTPServer records the requests and answers them with the status of the path, e.g. /500.
+func testHTTPServer(t *testing.T) (*httptest.Server, *[]testRequest) {
+	t.Helper()
+	var requests []testRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, testRequest{method: r.Method, header: r.Header, body: body})
+		switch r.URL.Path {
+		case "/500":
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "internal error")
+		case "/400":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "invalid payload")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestNotifierWebhook(t *testing.T) {
+	server, requests := testHTTPServer(t)
+	long := strings.Repeat("ü", discordMaxContent+10)
+
+	tests := []struct {
+		kind string
+		info NotifierWebhookInfo
+		want map[string]interface{}
+	}{
+		{"slack", NotifierWebhookInfo{}, map[string]interface{}{"text": "Backup failed: db\nDuration: 3s\nError: connection refused"}},
+		{"discord", NotifierWebhookInfo{Template: "{{.backup_status}} {{.backup_name}}"}, map[string]interface{}{"content": "failed db"}},
+		{"discord", NotifierWebhookInfo{Template: long}, map[string]interface{}{"content": long[:len("ü")*(discordMaxContent-3)] + "..."}},
+		{"teams", NotifierWebhookInfo{Template: "a\nb"}, map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    "Backup failed: db",
+			"themeColor": "D00000",
+			"title":      "Backup failed: db",
+			"text":       "a\n\nb",
+		}},
+		{"slack", NotifierWebhookInfo{Template: "{{.backup_title}}", Body: `{"msg":{{json .message}},"job":"{{.backup_name}}"}`}, map[string]interface{}{"msg": "Backup failed", "job": "db"}},
+	}
+	for _, test := range tests {
+		test.info.URL = server.URL
+		test.info.Headers = map[string]string{"Authorization": "Bearer secret"}
+		notifier, err := newNotifier(NotificationInfo{Type: test.kind, Info: test.info})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = notifier.Notify(testNotification(false, nil))
+		if err != nil {
+			t.Errorf("%s: %v", test.kind, err)
+			continue
+		}
+		request := (*requests)[len(*requests)-1]
+		var got map[string]interface{}
+		err = json.Unmarshal(request.body, &got)
+		if err != nil {
+			t.Errorf("%s: invalid body %s", test.kind, request.body)
+			continue
+		}
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(test.want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: body = %s, want %s", test.kind, gotJSON, wantJSON)
+		}
+		if request.method != http.MethodPost || request.header.Get("Content-Type") != "application/json" || request.header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("%s: request %s %v", test.kind, request.method, request.header)
+		}
+	}
+}
+
+func TestNotifierWebhookErrors(t *testing.T) {
+	server, _ := testHTTPServer(t)
+	tests := []struct {
+		info NotifierWebhookInfo
+		want string
+	}{
+		{NotifierWebhookInfo{}, "url is required"},
+		{NotifierWebhookInfo{URL: server.URL + "/400"}, "slack webhook error: 400 Bad Request: invalid payload"},
+		{NotifierWebhookInfo{URL: server.URL, Template: "{{.backup_name"}, "template"},
+	}
+	for _, test := range tests {
+		err := (&notifierWebhook{kind: "slack", info: test.info}).Notify(testNotification(true, nil))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%+v: error = %v, want %q", test.info, err, test.want)
+		}
+	}
+}
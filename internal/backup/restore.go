@@ -0,0 +1,246 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/archive"
+	"github.com/xacnio/backupper/pkg/crypt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RestoreOptions struct {
+	// Destination is the name (or type) of the destination to restore from, the first one by default.
+	Destination string
+	// At selects the run: "latest", its date suffix, or a time, in which case the
+	// newest run not after it is picked.
+	At         string
+	To         string
+	Identity   string
+	Passphrase string
+}
+
+// findSnapshot picks a snapshot (sorted oldest first) by the "at" selector of RestoreOptions.
+func findSnapshot(snapshots []*Snapshot, at string) (*Snapshot, error) {
+	if len(snapshots) == 0 {
+		return nil, errors.New("no backup found")
+	}
+	if at == "" || at == "latest" {
+		return snapshots[len(snapshots)-1], nil
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Date == at {
+			return snapshot, nil
+		}
+	}
+
+	t, ok := parseTime(at)
+	if !ok {
+		return nil, fmt.Errorf("invalid time: %q", at)
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].Time.After(t) {
+			return snapshots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no backup found at or before %s", t.Format("2006-01-02 15:04:05"))
+}
+
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range []string{config.Get().DateFormat, time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, value, utils.TimeLocation)
+		if err == nil {
+			return t, true
+		}
+	}
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Unix(unix, 0).In(utils.TimeLocation), true
+	}
+	return time.Time{}, false
+}
+
+// Restore downloads a stored run into opts.To, verifies it against its manifest
+// (or the listed sizes if there is none), then decrypts and extracts it.
+func (b *Backup) Restore(opts RestoreOptions) (*Snapshot, error) {
+	dest, err := b.findDestination(opts.Destination)
+	if err != nil {
+		return nil, err
+	}
+	d, err := b.connectDestination(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Disconnect()
+
+	downloader, ok := d.(Downloader)
+	if !ok {
+		return nil, fmt.Errorf("destination type %q can't download files", dest.Type)
+	}
+	snapshots, err := b.listSnapshots(d, dest)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := findSnapshot(snapshots, opts.At)
+	if err != nil {
+		return nil, err
+	}
+	logger.Main.Infow("restore started", "name", b.Name, "destination", dest.displayName(), "date", snapshot.Date, "files", len(snapshot.Files))
+
+	// Download every file of the run under its original name
+	var localPaths []string
+	remoteNames := make(map[string]RemoteFile)
+	for _, file := range snapshot.Files {
+		localName, _, _, _ := parseRemoteFileName(file.Name)
+		relPath, ok := localRelPath(localName)
+		if !ok || relPath == "." {
+			return nil, fmt.Errorf("invalid remote file name: %q", file.Name)
+		}
+		localPath := filepath.Join(opts.To, relPath)
+		err = os.MkdirAll(filepath.Dir(localPath), 0777)
+		if err != nil {
+			return nil, err
+		}
+		err = downloader.Download(file.Name, localPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		logger.Main.Debugw("restore downloaded", "name", b.Name, "file", file.Name)
+		if localName != manifestFileName {
+			localPaths = append(localPaths, localPath)
+			remoteNames[localPath] = file
+		}
+	}
+
+	manifest, err := readManifest(filepath.Join(opts.To, manifestFileName), snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyRestore(manifest, localPaths, remoteNames)
+	if err != nil {
+		return nil, err
+	}
+	logger.Main.Debugw("restore verified", "name", b.Name, "manifest", manifest != nil)
+
+	// Undo the encryption stage
+	decrypters := make(map[string]*crypt.Decrypter)
+	for i, localPath := range localPaths {
+		format := strings.TrimPrefix(filepath.Ext(localPath), ".")
+		if !crypt.IsSupported(format) {
+			continue
+		}
+		if opts.Identity == "" {
+			return nil, errors.New("backup is encrypted, an identity is needed")
+		}
+		decrypter, ok := decrypters[format]
+		if !ok {
+			decrypter, err = crypt.NewDecrypter(format, opts.Identity, opts.Passphrase)
+			if err != nil {
+				return nil, err
+			}
+			decrypters[format] = decrypter
+		}
+		dst := strings.TrimSuffix(localPath, crypt.Extension(format))
+		err = decrypter.DecryptFile(localPath, dst)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", localPath, err)
+		}
+		err = os.Remove(localPath)
+		if err != nil {
+			return nil, err
+		}
+		localPaths[i] = dst
+	}
+
+	// Undo the archive stage
+	if b.Archive != nil || (manifest != nil && manifest.Archive != "") {
+		for _, localPath := range localPaths {
+			format := archive.FormatOf(localPath)
+			if format == "" {
+				continue
+			}
+			err = archive.Extract(format, localPath, filepath.Dir(localPath))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", localPath, err)
+			}
+			err = os.Remove(localPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	logger.Main.Infow("restore finished", "name", b.Name, "destination", dest.displayName(), "date", snapshot.Date, "to", opts.To)
+	return snapshot, nil
+}
+
+// verifyRestore checks the downloaded files against the manifest, every listed
+// file must be downloaded with its size and checksum and no other file may be.
+// Without a manifest only the listed remote sizes are checked.
+func verifyRestore(manifest *Manifest, localPaths []string, remoteNames map[string]RemoteFile) error {
+	listed := make(map[string]ManifestFile)
+	if manifest != nil {
+		for _, f := range manifest.Files {
+			listed[f.RemoteName] = f
+		}
+	}
+
+	downloaded := make(map[string]bool)
+	for _, localPath := range localPaths {
+		file := remoteNames[localPath]
+		downloaded[file.Name] = true
+		hash, size, err := utils.FileSHA256(localPath)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			if file.Size != size {
+				return fmt.Errorf("%s: size mismatch, remote %d bytes, local %d bytes", file.Name, file.Size, size)
+			}
+			continue
+		}
+		f, ok := listed[file.Name]
+		if !ok {
+			return fmt.Errorf("%s: not in the manifest", file.Name)
+		}
+		if f.Size != size {
+			return fmt.Errorf("%s: size mismatch, manifest %d bytes, local %d bytes", file.Name, f.Size, size)
+		}
+		if !strings.EqualFold(f.SHA256, hash) {
+			return fmt.Errorf("%s: checksum mismatch", file.Name)
+		}
+	}
+
+	for _, f := range listed {
+		if !downloaded[f.RemoteName] {
+			return fmt.Errorf("%s: listed in the manifest but missing", f.RemoteName)
+		}
+	}
+	return nil
+}
+
+// readManifest reads and removes the downloaded manifest of the snapshot, it
+// returns nil if the run was uploaded without one.
+func readManifest(manifestPath string, snapshot *Snapshot) (*Manifest, error) {
+	if _, ok := snapshot.manifestFile(); !ok {
+		return nil, nil
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &manifest, os.Remove(manifestPath)
+}
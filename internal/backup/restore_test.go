@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRestore(t *testing.T) {
+	dir := t.TempDir()
+	dumpPath := filepath.Join(dir, "dump.sql")
+	otherPath := filepath.Join(dir, "other.sql")
+	writeTestFile(t, dumpPath, "dump")
+	writeTestFile(t, otherPath, "other")
+	// SHA-256 of "dump"
+	dumpHash := "b6ca0868bca6a2926b70aa1a71592038d9030fe26d4214edcfbd6cf41f2f4654"
+
+	remoteNames := map[string]RemoteFile{
+		dumpPath:  {Name: "dump-d.sql", Size: 4},
+		otherPath: {Name: "other-d.sql", Size: 5},
+	}
+	dump := ManifestFile{Name: "dump.sql", RemoteName: "dump-d.sql", Size: 4, SHA256: dumpHash}
+	tests := []struct {
+		name       string
+		manifest   *Manifest
+		localPaths []string
+		want       string
+	}{
+		{"no manifest", nil, []string{dumpPath, otherPath}, ""},
+		{"valid", &Manifest{Files: []ManifestFile{dump}}, []string{dumpPath}, ""},
+		{"missing", &Manifest{Files: []ManifestFile{dump, {RemoteName: "other-d.sql", Size: 5}}}, []string{dumpPath}, "other-d.sql: listed in the manifest but missing"},
+		{"not listed", &Manifest{Files: []ManifestFile{dump}}, []string{dumpPath, otherPath}, "other-d.sql: not in the manifest"},
+		{"size", &Manifest{Files: []ManifestFile{{RemoteName: "dump-d.sql", Size: 5, SHA256: dumpHash}}}, []string{dumpPath}, "size mismatch"},
+		{"checksum", &Manifest{Files: []ManifestFile{{RemoteName: "dump-d.sql", Size: 4, SHA256: strings.Repeat("0", 64)}}}, []string{dumpPath}, "checksum mismatch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyRestore(test.manifest, test.localPaths, remoteNames)
+			if test.want == "" && err != nil {
+				t.Errorf("error = %v", err)
+			}
+			if test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+				t.Errorf("error = %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	remoteNames[dumpPath] = RemoteFile{Name: "dump-d.sql", Size: 3}
+	err := verifyRestore(nil, []string{dumpPath}, remoteNames)
+	if err == nil || !strings.Contains(err.Error(), "remote 3 bytes") {
+		t.Errorf("error = %v, want a remote size mismatch", err)
+	}
+}
@@ -0,0 +1,317 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"time"
+)
+
+var (
+	errRetentionNotSupported = errors.New("destination doesn't support retention")
+	// errRetentionUnfiltered is returned if the files of the backup can't be
+	// told apart from the other files of the destination.
+	errRetentionUnfiltered = errors.New("retention refused, the files of the backup are unknown without source paths or a manifest")
+)
+
+const (
+	PruneByGFS   = "gfs"
+	PruneByCount = "count"
+	PruneBySize  = "size"
+	PruneByDate  = "date"
+)
+
+// defaultMinKeep is the number of runs retention keeps if "minKeep" is not set.
+const defaultMinKeep = 1
+
+// gfsRule keeps the newest run of each of the last count time buckets.
+type gfsRule struct {
+	name   string
+	count  *int
+	bucket func(t time.Time) string
+}
+
+func (info RetentionInfo) gfsRules() []gfsRule {
+	return []gfsRule{
+		{"last", info.KeepLast, func(t time.Time) string { return t.String() }},
+		{"hourly", info.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02 15h") }},
+		{"daily", info.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", info.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", info.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", info.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+func (info RetentionInfo) gfsEnabled() bool {
+	for _, rule := range info.gfsRules() {
+		if rule.count != nil && *rule.count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (info RetentionInfo) enabled() bool {
+	return info.gfsEnabled() ||
+		(info.LimitByCount != nil && *info.LimitByCount > 0) ||
+		(info.LimitBySize != nil && *info.LimitBySize > 0) ||
+		info.LimitByDate != nil
+}
+
+// plan evaluates the retention rules per run and returns the snapshots (sorted
+// oldest first) which would be deleted, their PruneReason is set to the rule.
+// The GFS rules are applied first, then count, size and date on the remaining runs.
+// At least minKeep runs are kept, the newest deletions are skipped for that.
+func (info RetentionInfo) plan(snapshots []*Snapshot) []*Snapshot {
+	for _, snapshot := range snapshots {
+		snapshot.PruneReason = ""
+		snapshot.KeepReasons = nil
+		snapshot.PruneSkipped = ""
+	}
+	remaining := snapshots
+
+	if info.gfsEnabled() {
+		// Buckets are taken in the configured timezone, newest run first
+		for _, rule := range info.gfsRules() {
+			if rule.count == nil || *rule.count <= 0 {
+				continue
+			}
+			count := *rule.count
+			lastBucket := ""
+			for i := len(snapshots) - 1; i >= 0 && count > 0; i-- {
+				bucket := rule.bucket(snapshots[i].Time.In(utils.TimeLocation))
+				if bucket == lastBucket {
+					continue
+				}
+				lastBucket = bucket
+				count--
+				if rule.name == "last" {
+					snapshots[i].KeepReasons = append(snapshots[i].KeepReasons, rule.name)
+				} else {
+					snapshots[i].KeepReasons = append(snapshots[i].KeepReasons, rule.name+" "+bucket)
+				}
+			}
+		}
+
+		remaining = nil
+		for _, snapshot := range snapshots {
+			if len(snapshot.KeepReasons) == 0 {
+				snapshot.PruneReason = PruneByGFS
+			} else {
+				remaining = append(remaining, snapshot)
+			}
+		}
+	}
+
+	if info.LimitByCount != nil && *info.LimitByCount > 0 && len(remaining) > *info.LimitByCount {
+		diff := len(remaining) - *info.LimitByCount
+		for _, snapshot := range remaining[:diff] {
+			snapshot.PruneReason = PruneByCount
+		}
+		remaining = remaining[diff:]
+	}
+
+	if info.LimitBySize != nil && *info.LimitBySize > 0 {
+		var totalSize int64
+		for _, snapshot := range remaining {
+			totalSize += snapshot.Size
+		}
+		diff := totalSize - *info.LimitBySize
+		i := 0
+		for ; i < len(remaining) && diff > 0; i++ {
+			diff -= remaining[i].Size
+			remaining[i].PruneReason = PruneBySize
+		}
+		remaining = remaining[i:]
+	}
+
+	if info.LimitByDate != nil && len(snapshots) > 0 {
+		// A cutoff after the newest run would delete every run, ignore it
+		beforeTime, ok := utils.ParseDurationPattern(*info.LimitByDate, true)
+		if ok && !beforeTime.After(snapshots[len(snapshots)-1].Time) {
+			for _, snapshot := range remaining {
+				if snapshot.Time.Before(beforeTime) {
+					snapshot.PruneReason = PruneByDate
+				}
+			}
+		}
+	}
+
+	minKeep := defaultMinKeep
+	if info.MinKeep != nil && *info.MinKeep >= 0 {
+		minKeep = *info.MinKeep
+	}
+	var pruned []*Snapshot
+	kept := len(snapshots)
+	for _, snapshot := range snapshots {
+		if snapshot.PruneReason != "" {
+			pruned = append(pruned, snapshot)
+			kept--
+		}
+	}
+	for len(pruned) > 0 && kept < minKeep {
+		snapshot := pruned[len(pruned)-1]
+		snapshot.PruneSkipped = snapshot.PruneReason
+		snapshot.PruneReason = ""
+		snapshot.KeepReasons = append(snapshot.KeepReasons, "minKeep")
+		pruned = pruned[:len(pruned)-1]
+		kept++
+	}
+	return pruned
+}
+
+// pruneDestination deletes the runs on a connected destination which are not
+// kept by its retention rules. It returns every run of the backup, the deleted
+// ones with their PruneReason set, and the deleted files. With dryRun nothing
+// is deleted.
+func (b *Backup) pruneDestination(d Destination, dest *DestinationInfo, dryRun bool) ([]*Snapshot, []string, error) {
+	info := utils.ConvertToStruct[RetentionInfo](dest.Info)
+	if !info.enabled() {
+		return nil, nil, nil
+	}
+	deleter, ok := d.(Deleter)
+	if !ok {
+		return nil, nil, errRetentionNotSupported
+	}
+
+	if !b.knowsFiles() {
+		return nil, nil, errRetentionUnfiltered
+	}
+
+	snapshots, err := b.listSnapshots(d, dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	pruned := info.plan(snapshots)
+	for _, snapshot := range snapshots {
+		if snapshot.PruneSkipped != "" {
+			logger.Main.Warnw("retention skipped by minKeep", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "date", snapshot.Date, "reason", snapshot.PruneSkipped)
+		}
+	}
+	if dryRun {
+		return snapshots, nil, nil
+	}
+
+	var deleteErr error
+	var deletedFiles []string
+	for _, snapshot := range pruned {
+		var deleted []string
+		for _, file := range snapshot.Files {
+			err = deleter.Delete(file.Name)
+			if err != nil {
+				logger.Main.Errorw("retention delete error", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "file", file.Name, "error", err)
+				deleteErr = err
+				continue
+			}
+			deleted = append(deleted, file.Name)
+		}
+		logger.Main.Infow("retention deleted", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "date", snapshot.Date, "reason", snapshot.PruneReason, "deleted", deleted)
+		deletedFiles = append(deletedFiles, deleted...)
+	}
+	return snapshots, deletedFiles, deleteErr
+}
+
+// applyRetention runs the retention rules of a destination after an upload,
+// skipped deletions are added to the warnings of the destination result.
+func (b *Backup) applyRetention(d Destination, dest *DestinationInfo) {
+	snapshots, deleted, err := b.pruneDestination(d, dest, false)
+	dest.Result.DeletedFiles = append(dest.Result.DeletedFiles, deleted...)
+	if err == errRetentionNotSupported {
+		logger.Main.Warnw("retention not supported", "name", b.Name, "id", b.ID, "destination", dest.displayName())
+	} else if err == errRetentionUnfiltered {
+		logger.Main.Warnw("retention refused", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "error", err)
+		dest.Result.Warnings = append(dest.Result.Warnings, err.Error())
+	} else if err != nil {
+		logger.Main.Errorw("retention error", "name", b.Name, "id", b.ID, "destination", dest.displayName(), "error", err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.PruneSkipped != "" {
+			dest.Result.Warnings = append(dest.Result.Warnings, fmt.Sprintf("retention skipped %s (%s): minKeep", snapshot.Date, snapshot.PruneSkipped))
+		}
+	}
+}
+
+// Prune applies the retention rules of every destination (or only the one with
+// the given name) without uploading anything. With dryRun nothing is deleted,
+// otherwise the run is recorded in the history like a scheduled prune.
+func (b *Backup) Prune(destination string, dryRun bool) ([]DestinationSnapshots, error) {
+	if dryRun {
+		return b.eachDestination(destination, func(d Destination, dest *DestinationInfo) ([]*Snapshot, error) {
+			snapshots, _, err := b.pruneDestination(d, dest, true)
+			return snapshots, err
+		})
+	}
+	p := *b
+	return p.prune(destination)
+}
+
+// CreatePruneFunc returns the job of the "pruneCronExpr" schedule.
+func (b *Backup) CreatePruneFunc() func() {
+	p := *b
+	return func() {
+		_, _ = p.prune("")
+	}
+}
+
+// prune deletes the snapshots removed by the retention rules and records a
+// prune run. The ID and start time of b are replaced, so it is called on a copy.
+func (b *Backup) prune(destination string) ([]DestinationSnapshots, error) {
+	b.StartedAt = time.Now()
+	b.ID = b.StartedAt.UnixNano()
+	logger.StartCapture(b.ID)
+
+	logger.Main.Infow("prune started", "name", b.Name, "id", b.ID)
+
+	run := &history.Run{
+		Kind:      history.KindPrune,
+		Job:       b.Name,
+		ID:        b.ID,
+		StartedAt: b.StartedAt,
+		Success:   true,
+	}
+	deleted := make(map[string][]string)
+	lists, err := b.eachDestination(destination, func(d Destination, dest *DestinationInfo) ([]*Snapshot, error) {
+		snapshots, files, err := b.pruneDestination(d, dest, false)
+		deleted[dest.displayName()] = files
+		return snapshots, err
+	})
+	if err != nil {
+		logger.StopCapture(b.ID)
+		return nil, err
+	}
+	for _, list := range lists {
+		result := history.Destination{
+			Name:    list.Destination,
+			Type:    list.Type,
+			Success: list.Error == "",
+			Error:   list.Error,
+			Deleted: deleted[list.Destination],
+		}
+		for _, snapshot := range list.Snapshots {
+			if snapshot.PruneSkipped != "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("retention skipped %s (%s): minKeep", snapshot.Date, snapshot.PruneSkipped))
+			}
+		}
+		if list.Error != "" {
+			run.Success = false
+			run.Error = list.Error
+			logger.Main.Errorw("prune error", "name", b.Name, "id", b.ID, "destination", list.Destination, "error", list.Error)
+		}
+		run.Destinations = append(run.Destinations, result)
+		run.Deleted += len(result.Deleted)
+	}
+
+	logger.Main.Infow("prune finished", "name", b.Name, "id", b.ID)
+	run.FinishedAt = time.Now()
+	run.Log = logger.StopCapture(b.ID)
+	err = history.Record(run)
+	if err != nil {
+		logger.Main.Errorw("history error", "name", b.Name, "id", b.ID, "error", err)
+	}
+	return lists, nil
+}
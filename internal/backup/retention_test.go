@@ -0,0 +1,264 @@
+package backup
+
+import (
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/history"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func testSnapshots(sizes []int64, times ...time.Time) []*Snapshot {
+	var snapshots []*Snapshot
+	for i, t := range times {
+		snapshot := &Snapshot{Date: t.Format(testDateFormat), Time: t, Size: 1}
+		if sizes != nil {
+			snapshot.Size = sizes[i]
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+func testDate(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestRetentionPlan(t *testing.T) {
+	now := time.Now()
+	limitBySize := int64(10)
+	twoDays := "2 DAYS"
+	invalidDate := "two days"
+
+	tests := []struct {
+		name      string
+		info      RetentionInfo
+		snapshots []*Snapshot
+		// prune is the PruneReason of every snapshot, keep their joined KeepReasons if set
+		prune   []string
+		keep    []string
+		skipped []string
+	}{
+		{
+			name:      "none",
+			snapshots: testSnapshots(nil, testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00")),
+			prune:     []string{"", ""},
+		},
+		{
+			name:      "count",
+			info:      RetentionInfo{LimitByCount: intPtr(2)},
+			snapshots: testSnapshots(nil, testDate("2023-07-17 10:00"), testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneByCount, PruneByCount, "", ""},
+		},
+		{
+			name:      "count not reached",
+			info:      RetentionInfo{LimitByCount: intPtr(5)},
+			snapshots: testSnapshots(nil, testDate("2023-07-17 10:00"), testDate("2023-07-18 10:00")),
+			prune:     []string{"", ""},
+		},
+		{
+			name:      "size",
+			info:      RetentionInfo{LimitBySize: &limitBySize},
+			snapshots: testSnapshots([]int64{5, 5, 4, 4}, testDate("2023-07-17 10:00"), testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneBySize, PruneBySize, "", ""},
+		},
+		{
+			name:      "date",
+			info:      RetentionInfo{LimitByDate: &twoDays},
+			snapshots: testSnapshots(nil, now.Add(-5*24*time.Hour), now.Add(-3*24*time.Hour), now.Add(-24*time.Hour), now),
+			prune:     []string{PruneByDate, PruneByDate, "", ""},
+		},
+		{
+			name:      "date after the newest run",
+			info:      RetentionInfo{LimitByDate: &twoDays, MinKeep: intPtr(0)},
+			snapshots: testSnapshots(nil, now.Add(-5*24*time.Hour), now.Add(-4*24*time.Hour), now.Add(-3*24*time.Hour)),
+			prune:     []string{"", "", ""},
+		},
+		{
+			name:      "invalid date",
+			info:      RetentionInfo{LimitByDate: &invalidDate},
+			snapshots: testSnapshots(nil, now.Add(-5*24*time.Hour), now),
+			prune:     []string{"", ""},
+		},
+		{
+			name:      "daily",
+			info:      RetentionInfo{KeepDaily: intPtr(2)},
+			snapshots: testSnapshots(nil, testDate("2023-07-18 10:00"), testDate("2023-07-19 09:00"), testDate("2023-07-19 18:00"), testDate("2023-07-20 08:00")),
+			prune:     []string{PruneByGFS, PruneByGFS, "", ""},
+			keep:      []string{"", "", "daily 2023-07-19", "daily 2023-07-20"},
+		},
+		{
+			name:      "hourly and weekly",
+			info:      RetentionInfo{KeepHourly: intPtr(1), KeepWeekly: intPtr(2)},
+			snapshots: testSnapshots(nil, testDate("2023-07-03 10:00"), testDate("2023-07-12 10:00"), testDate("2023-07-13 10:00"), testDate("2023-07-20 08:00"), testDate("2023-07-20 08:30")),
+			prune:     []string{PruneByGFS, PruneByGFS, "", PruneByGFS, ""},
+			keep:      []string{"", "", "weekly 2023-W28", "", "hourly 2023-07-20 08h,weekly 2023-W29"},
+		},
+		{
+			name:      "last, monthly and yearly",
+			info:      RetentionInfo{KeepLast: intPtr(1), KeepMonthly: intPtr(2), KeepYearly: intPtr(2)},
+			snapshots: testSnapshots(nil, testDate("2022-12-31 10:00"), testDate("2023-06-10 10:00"), testDate("2023-06-20 10:00"), testDate("2023-07-05 10:00"), testDate("2023-07-10 10:00")),
+			prune:     []string{"", PruneByGFS, "", PruneByGFS, ""},
+			keep:      []string{"yearly 2022", "", "monthly 2023-06", "", "last,monthly 2023-07,yearly 2023"},
+		},
+		{
+			name:      "gfs then count",
+			info:      RetentionInfo{KeepDaily: intPtr(3), LimitByCount: intPtr(1)},
+			snapshots: testSnapshots(nil, testDate("2023-07-17 10:00"), testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneByGFS, PruneByCount, PruneByCount, ""},
+		},
+		{
+			name:      "minKeep default",
+			info:      RetentionInfo{LimitBySize: &limitBySize},
+			snapshots: testSnapshots([]int64{5, 5, 20}, testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneBySize, PruneBySize, ""},
+			keep:      []string{"", "", "minKeep"},
+			skipped:   []string{"", "", PruneBySize},
+		},
+		{
+			name:      "minKeep",
+			info:      RetentionInfo{LimitByCount: intPtr(1), MinKeep: intPtr(3)},
+			snapshots: testSnapshots(nil, testDate("2023-07-17 10:00"), testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneByCount, "", "", ""},
+			skipped:   []string{"", PruneByCount, PruneByCount, ""},
+		},
+		{
+			name:      "minKeep with gfs",
+			info:      RetentionInfo{KeepDaily: intPtr(1), MinKeep: intPtr(2)},
+			snapshots: testSnapshots(nil, testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneByGFS, "", ""},
+			keep:      []string{"", "minKeep", "daily 2023-07-20"},
+			skipped:   []string{"", PruneByGFS, ""},
+		},
+		{
+			name:      "minKeep zero",
+			info:      RetentionInfo{LimitBySize: &limitBySize, MinKeep: intPtr(0)},
+			snapshots: testSnapshots([]int64{5, 5, 20}, testDate("2023-07-18 10:00"), testDate("2023-07-19 10:00"), testDate("2023-07-20 10:00")),
+			prune:     []string{PruneBySize, PruneBySize, PruneBySize},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pruned := test.info.plan(test.snapshots)
+			var wantPruned int
+			for i, snapshot := range test.snapshots {
+				if snapshot.PruneReason != test.prune[i] {
+					t.Errorf("snapshot %d prune reason = %q, want %q", i, snapshot.PruneReason, test.prune[i])
+				}
+				if test.prune[i] != "" {
+					wantPruned++
+				}
+				if test.skipped != nil && snapshot.PruneSkipped != test.skipped[i] {
+					t.Errorf("snapshot %d skipped = %q, want %q", i, snapshot.PruneSkipped, test.skipped[i])
+				}
+				if test.keep != nil && strings.Join(snapshot.KeepReasons, ",") != test.keep[i] {
+					t.Errorf("snapshot %d keep reasons = %q, want %q", i, snapshot.KeepReasons, test.keep[i])
+				}
+			}
+			if len(pruned) != wantPruned {
+				t.Errorf("plan returned %d snapshots, want %d", len(pruned), wantPruned)
+			}
+		})
+	}
+}
+
+func TestPruneUnknownFiles(t *testing.T) {
+	target := t.TempDir()
+	writeTestFile(t, filepath.Join(target, "other-2001-01-01__00-00-00.txt"), "other")
+
+	// The files of an S3 source with a prefix are only known by the manifest
+	manifest := false
+	keepLast := 1
+	b := &Backup{
+		Name:        "s3",
+		Manifest:    &manifest,
+		Source:      SourceInfo{Type: "s3", Info: map[string]interface{}{"prefix": "db/"}},
+		Destination: DestinationInfo{Type: "local", Info: DestinationLocalInfo{Target: target, RetentionInfo: RetentionInfo{KeepLast: &keepLast}}},
+	}
+	lists, err := b.Prune("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || lists[0].Error != errRetentionUnfiltered.Error() {
+		t.Errorf("prune = %+v, want %q", lists, errRetentionUnfiltered)
+	}
+	if got := readTestDir(t, target); len(got) != 1 {
+		t.Errorf("target has %q, want the file of the other job", got)
+	}
+
+	// A template with .Time can't be matched either
+	b.Source = SourceInfo{Type: "local", Info: SourceLocalInfo{Paths: []string{"/var/lib/db.sql"}}}
+	b.Archive = &ArchiveInfo{Name: `{{.Name}}-{{.Time.Unix}}`}
+	if b.knowsFiles() {
+		t.Error("archive name with .Time is known")
+	}
+	b.Archive.Name = "{{.Name}}-{{.Date}}"
+	if !b.knowsFiles() {
+		t.Error("archive name with .Date is unknown")
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.db")
+	config.Set(&config.Config{DateFormat: testDateFormat, HistoryFile: &historyFile})
+	defer config.Set(&config.Config{DateFormat: testDateFormat})
+
+	target := t.TempDir()
+	for _, date := range []string{"2023-07-18__10-30-00", "2023-07-19__10-30-00", "2023-07-20__10-30-00"} {
+		writeTestFile(t, filepath.Join(target, "db-"+date+".sql"), "dump")
+	}
+	keepLast := 1
+	b := &Backup{
+		Name:        "db",
+		Source:      SourceInfo{Type: "local", Info: SourceLocalInfo{Paths: []string{"/var/lib/db.sql"}}},
+		Destination: DestinationInfo{Type: "local", Info: DestinationLocalInfo{Target: target, RetentionInfo: RetentionInfo{KeepLast: &keepLast}}},
+	}
+
+	// A dry run deletes and records nothing
+	_, err := b.Prune("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestDir(t, target); len(got) != 3 {
+		t.Errorf("dry run left %q", got)
+	}
+	runs, err := history.List("db", 0)
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("history after dry run = %+v, %v", runs, err)
+	}
+
+	_, err = b.Prune("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestDir(t, target); strings.Join(got, ",") != "db-2023-07-20__10-30-00.sql" {
+		t.Errorf("target has %q", got)
+	}
+	runs, err = history.List("db", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Kind != history.KindPrune || !runs[0].Success || runs[0].Deleted != 2 {
+		t.Fatalf("history = %+v", runs)
+	}
+	if b.ID != 0 {
+		t.Errorf("prune changed the ID of the job to %d", b.ID)
+	}
+
+	_, err = b.Prune("offsite", false)
+	if err == nil {
+		t.Error("prune of an unknown destination didn't fail")
+	}
+	if runs, _ = history.List("db", 0); len(runs) != 1 {
+		t.Errorf("unknown destination recorded a run, history has %d", len(runs))
+	}
+}
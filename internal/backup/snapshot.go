@@ -0,0 +1,350 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/pkg/archive"
+	"github.com/xacnio/backupper/pkg/crypt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type RemoteFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Snapshot is a stored backup run: every file of a destination with the same date suffix.
+type Snapshot struct {
+	Date  string       `json:"date"`
+	Time  time.Time    `json:"time"`
+	Files []RemoteFile `json:"files"`
+	Size  int64        `json:"size"`
+	// PruneReason is the retention rule which would delete the run, if any.
+	PruneReason string `json:"pruneReason,omitempty"`
+	// KeepReasons are the GFS buckets the run is kept for, e.g. "daily 2023-07-20".
+	KeepReasons []string `json:"keepReasons,omitempty"`
+	// PruneSkipped is the rule which would delete the run if minKeep allowed it.
+	PruneSkipped string `json:"pruneSkipped,omitempty"`
+}
+
+// DestinationSnapshots is the list of stored runs of a destination.
+type DestinationSnapshots struct {
+	Destination string      `json:"destination"`
+	Type        string      `json:"type"`
+	Snapshots   []*Snapshot `json:"snapshots"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// parseRemoteFileName splits a name created by remoteFileName into the local
+// name and the date suffix, e.g. "db/dump-<date>.sql" -> "db/dump.sql", <date>.
+func parseRemoteFileName(remoteName string) (string, string, time.Time, bool) {
+	dateFormat := config.Get().DateFormat
+	dir, name := path.Split(remoteName)
+	base, ext := splitExt(name)
+
+	// Try the shortest suffix first, the date itself may contain dashes
+	for i := strings.LastIndex(base, "-"); i > 0; i = strings.LastIndex(base[:i], "-") {
+		date := base[i+1:]
+		t, err := time.ParseInLocation(dateFormat, date, utils.TimeLocation)
+		if err != nil || t.Format(dateFormat) != date {
+			continue
+		}
+		return dir + base[:i] + ext, date, t, true
+	}
+	return "", "", time.Time{}, false
+}
+
+// groupSnapshots groups remote files by their date suffix, oldest first. Files
+// without a date suffix don't belong to any run and are skipped.
+func groupSnapshots(files []RemoteFile) []*Snapshot {
+	byDate := make(map[string]*Snapshot)
+	var snapshots []*Snapshot
+	for _, file := range files {
+		_, date, t, ok := parseRemoteFileName(file.Name)
+		if !ok {
+			continue
+		}
+		snapshot, exists := byDate[date]
+		if !exists {
+			snapshot = &Snapshot{Date: date, Time: t}
+			byDate[date] = snapshot
+			snapshots = append(snapshots, snapshot)
+		}
+		snapshot.Files = append(snapshot.Files, file)
+		snapshot.Size += file.Size
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	for _, snapshot := range snapshots {
+		sort.Slice(snapshot.Files, func(i, j int) bool {
+			return snapshot.Files[i].Name < snapshot.Files[j].Name
+		})
+	}
+	return snapshots
+}
+
+// manifestFile returns the manifest uploaded with the snapshot, if any.
+func (s *Snapshot) manifestFile() (RemoteFile, bool) {
+	for _, file := range s.Files {
+		localName, _, _, _ := parseRemoteFileName(file.Name)
+		if localName == manifestFileName {
+			return file, true
+		}
+	}
+	return RemoteFile{}, false
+}
+
+// findDestination returns the destination of the backup with the given name
+// (or type), or the first destination if name is empty.
+func (b *Backup) findDestination(name string) (*DestinationInfo, error) {
+	dests := b.destinations()
+	if len(dests) == 0 {
+		return nil, errors.New("no destination")
+	}
+	if name == "" {
+		return dests[0], nil
+	}
+	for _, dest := range dests {
+		if dest.Name == name || (dest.Name == "" && dest.Type == name) {
+			return dest, nil
+		}
+	}
+	return nil, fmt.Errorf("destination not found: %q", name)
+}
+
+func (b *Backup) connectDestination(dest *DestinationInfo) (Destination, error) {
+	d, err := newDestination(*dest)
+	if err != nil {
+		return nil, err
+	}
+	err = d.Connect(b)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// listSnapshots lists the stored runs of the backup on a destination. Only the
+// files of this backup are returned, other files in the target are left out.
+func (b *Backup) listSnapshots(d Destination, dest *DestinationInfo) ([]*Snapshot, error) {
+	lister, ok := d.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("destination type %q can't list files", dest.Type)
+	}
+	files, err := lister.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, snapshot := range groupSnapshots(files) {
+		patterns, ok := b.filePatterns(snapshot)
+		if ok {
+			snapshot.filter(func(file RemoteFile) bool {
+				localName, _, _, _ := parseRemoteFileName(file.Name)
+				return matchPatterns(patterns, localName)
+			})
+			// A manifest alone belongs to another backup
+			if len(snapshot.Files) == 1 {
+				if _, isManifest := snapshot.manifestFile(); isManifest {
+					continue
+				}
+			}
+		} else if b.manifestEnabled() {
+			err = b.filterByManifest(d, snapshot)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(snapshot.Files) > 0 {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// knowsFiles reports whether the files of the backup can be told apart from
+// other files of a destination, by the source patterns or by the manifest.
+func (b *Backup) knowsFiles() bool {
+	_, ok := b.filePatterns(&Snapshot{})
+	return ok || b.manifestEnabled()
+}
+
+// filePatterns returns the patterns of the local names the backup uploads in
+// a run. It returns false if a source can't tell the names of its files.
+func (b *Backup) filePatterns(snapshot *Snapshot) ([]string, bool) {
+	var patterns []string
+	if b.manifestEnabled() {
+		patterns = append(patterns, manifestFileName)
+	}
+
+	if b.Archive != nil {
+		info := *b.Archive
+		if info.Format == "" {
+			info.Format = archive.FormatTarGz
+		}
+		name, err := renderArchiveName(info, archiveMatchData{
+			Name: b.Name,
+			ID:   "*",
+			Date: snapshot.Date,
+		})
+		if err != nil {
+			return nil, false
+		}
+		return append(patterns, name), true
+	}
+
+	for _, src := range b.sources() {
+		source, err := newSource(*src)
+		if err != nil {
+			return nil, false
+		}
+		patterner, ok := source.(Patterner)
+		if !ok {
+			return nil, false
+		}
+		srcPatterns := patterner.Patterns()
+		if len(srcPatterns) == 0 {
+			return nil, false
+		}
+		for _, pattern := range srcPatterns {
+			if src.Folder != "" {
+				pattern = path.Join(filepath.ToSlash(filepath.Clean(src.Folder)), pattern)
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, len(patterns) > 0
+}
+
+// matchPatterns reports whether a local name (or one of its folders) matches
+// one of the patterns. The encryption extension is ignored.
+func matchPatterns(patterns []string, localName string) bool {
+	for _, ext := range []string{crypt.Extension(crypt.FormatAge), crypt.Extension(crypt.FormatGPG)} {
+		localName = strings.TrimSuffix(localName, ext)
+	}
+	for _, pattern := range patterns {
+		for p := localName; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterByManifest keeps the files listed in the manifest of the run, runs
+// of other backups or without a manifest are emptied.
+func (b *Backup) filterByManifest(d Destination, snapshot *Snapshot) error {
+	manifestFile, ok := snapshot.manifestFile()
+	downloader, canDownload := d.(Downloader)
+	if !ok || !canDownload {
+		snapshot.filter(func(RemoteFile) bool { return false })
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "backupper-manifest-*.json")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	err = downloader.Download(manifestFile.Name, f.Name())
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	var manifest Manifest
+	if json.Unmarshal(data, &manifest) != nil || manifest.BackupName != b.Name {
+		snapshot.filter(func(RemoteFile) bool { return false })
+		return nil
+	}
+
+	tracked := map[string]bool{manifestFile.Name: true}
+	for _, file := range manifest.Files {
+		tracked[file.RemoteName] = true
+	}
+	snapshot.filter(func(file RemoteFile) bool {
+		return tracked[file.Name]
+	})
+	return nil
+}
+
+// filter keeps the files which pass keep.
+func (s *Snapshot) filter(keep func(file RemoteFile) bool) {
+	var files []RemoteFile
+	s.Size = 0
+	for _, file := range s.Files {
+		if keep(file) {
+			files = append(files, file)
+			s.Size += file.Size
+		}
+	}
+	s.Files = files
+}
+
+// ListSnapshots lists the stored runs of every destination (or only the one
+// with the given name) and marks the runs the retention rules would delete.
+func (b *Backup) ListSnapshots(destination string) ([]DestinationSnapshots, error) {
+	return b.eachDestination(destination, func(d Destination, dest *DestinationInfo) ([]*Snapshot, error) {
+		snapshots, err := b.listSnapshots(d, dest)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := d.(Deleter); ok {
+			utils.ConvertToStruct[RetentionInfo](dest.Info).plan(snapshots)
+		}
+		return snapshots, nil
+	})
+}
+
+// eachDestination connects to every destination (or only the one with the
+// given name) and collects the runs returned by fn.
+func (b *Backup) eachDestination(destination string, fn func(d Destination, dest *DestinationInfo) ([]*Snapshot, error)) ([]DestinationSnapshots, error) {
+	dests := b.destinations()
+	if destination != "" {
+		dest, err := b.findDestination(destination)
+		if err != nil {
+			return nil, err
+		}
+		dests = []*DestinationInfo{dest}
+	}
+
+	var result []DestinationSnapshots
+	for _, dest := range dests {
+		list := DestinationSnapshots{
+			Destination: dest.displayName(),
+			Type:        dest.Type,
+			Snapshots:   []*Snapshot{},
+		}
+		d, err := b.connectDestination(dest)
+		if err != nil {
+			list.Error = err.Error()
+			result = append(result, list)
+			continue
+		}
+		snapshots, err := fn(d, dest)
+		d.Disconnect()
+		if err != nil {
+			list.Error = err.Error()
+		} else if snapshots != nil {
+			list.Snapshots = snapshots
+		}
+		result = append(result, list)
+	}
+	return result, nil
+}
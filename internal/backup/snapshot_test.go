@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/pkg/archive"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitExt(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		ext  string
+	}{
+		{"dump.sql", "dump", ".sql"},
+		{"backup.tar.gz", "backup", ".tar.gz"},
+		{"backup.TAR.ZST", "backup", ".TAR.ZST"},
+		{"backup.tar.xz", "backup", ".tar.xz"},
+		{"backup.tar.bz2", "backup", ".tar.bz2"},
+		{"dump.sql.age", "dump", ".sql.age"},
+		{"backup.tar.gz.gpg", "backup", ".tar.gz.gpg"},
+		{"my.dump.sql", "my.dump", ".sql"},
+		{"README", "README", ""},
+		{".tar.gz", ".tar", ".gz"},
+		{".age", "", ".age"},
+	}
+	for _, test := range tests {
+		base, ext := splitExt(test.name)
+		if base != test.base || ext != test.ext {
+			t.Errorf("splitExt(%q) = %q, %q, want %q, %q", test.name, base, ext, test.base, test.ext)
+		}
+	}
+}
+
+func TestParseRemoteFileName(t *testing.T) {
+	tests := []struct {
+		remoteName string
+		localName  string
+		date       string
+		ok         bool
+	}{
+		{"dump-2023-07-20__10-30-00.sql", "dump.sql", "2023-07-20__10-30-00", true},
+		{"db/my-dump-2023-07-20__10-30-00.sql", "db/my-dump.sql", "2023-07-20__10-30-00", true},
+		{"backup-2023-07-20__10-30-00.tar.gz.age", "backup.tar.gz.age", "2023-07-20__10-30-00", true},
+		{"manifest-2023-07-20__10-30-00.json", "manifest.json", "2023-07-20__10-30-00", true},
+		{"README-2023-07-20__10-30-00", "README", "2023-07-20__10-30-00", true},
+		{"dump.sql", "", "", false},
+		{"dump-2023-13-20__10-30-00.sql", "", "", false},
+		{"dump-2023-07-20.sql", "", "", false},
+		{"-2023-07-20__10-30-00.sql", "", "", false},
+	}
+	for _, test := range tests {
+		localName, date, tm, ok := parseRemoteFileName(test.remoteName)
+		if localName != test.localName || date != test.date || ok != test.ok {
+			t.Errorf("parseRemoteFileName(%q) = %q, %q, %v, want %q, %q, %v", test.remoteName, localName, date, ok, test.localName, test.date, test.ok)
+		}
+		if ok && !tm.Equal(time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC)) {
+			t.Errorf("parseRemoteFileName(%q) time = %v", test.remoteName, tm)
+		}
+	}
+}
+
+func TestRemoteFileNameRoundTrip(t *testing.T) {
+	b := &Backup{StartedAt: time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC)}
+	for _, name := range []string{"dump.sql", "db/dump.sql.age", "backup.tar.zst", "a-b-c.txt"} {
+		localName, _, _, ok := parseRemoteFileName(b.remoteFileName(name))
+		if !ok || localName != name {
+			t.Errorf("%q -> %q -> %q, %v", name, b.remoteFileName(name), localName, ok)
+		}
+	}
+}
+
+func TestRemoteFileNameTimeLocation(t *testing.T) {
+	utils.TimeLocation = time.FixedZone("UTC+3", 3*60*60)
+	defer func() { utils.TimeLocation = time.UTC }()
+
+	// The date of the names is in the configured timezone, whatever the location of StartedAt
+	startedAt := time.Date(2023, 7, 20, 22, 30, 0, 0, time.UTC)
+	b := &Backup{Name: "db", StartedAt: startedAt}
+	remoteName := b.remoteFileName("dump.sql")
+	if remoteName != "dump-2023-07-21__01-30-00.sql" {
+		t.Errorf("remote name = %q", remoteName)
+	}
+	_, _, tm, ok := parseRemoteFileName(remoteName)
+	if !ok || !tm.Equal(startedAt) {
+		t.Errorf("parsed time = %v, %v, want %v", tm, ok, startedAt)
+	}
+
+	name, err := b.archiveName(ArchiveInfo{Format: archive.FormatTarGz, Name: "{{.Name}}-{{.Time.Format \"2006-01-02\"}}"})
+	if err != nil || name != "db-2023-07-21.tar.gz" {
+		t.Errorf("archive name = %q, %v", name, err)
+	}
+}
+
+func TestGroupSnapshots(t *testing.T) {
+	snapshots := groupSnapshots([]RemoteFile{
+		{Name: "b-2023-07-21__00-00-00.sql", Size: 1},
+		{Name: "a-2023-07-20__00-00-00.sql", Size: 2},
+		{Name: "other.txt", Size: 4},
+		{Name: "a-2023-07-21__00-00-00.sql", Size: 8},
+	})
+	if len(snapshots) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(snapshots))
+	}
+	if snapshots[0].Date != "2023-07-20__00-00-00" || snapshots[0].Size != 2 || len(snapshots[0].Files) != 1 {
+		t.Errorf("first snapshot = %+v", snapshots[0])
+	}
+	if snapshots[1].Date != "2023-07-21__00-00-00" || snapshots[1].Size != 9 || len(snapshots[1].Files) != 2 {
+		t.Errorf("second snapshot = %+v", snapshots[1])
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		patterns  []string
+		localName string
+		want      bool
+	}{
+		{[]string{"dump.sql"}, "dump.sql", true},
+		{[]string{"dump.sql"}, "dump.sql.age", true},
+		{[]string{"dump.sql"}, "dump.sql.gpg", true},
+		{[]string{"dump.sql"}, "other.sql", false},
+		{[]string{"*.sql"}, "dump.sql", true},
+		{[]string{"*.sql"}, "db/dump.sql", false},
+		{[]string{"files"}, "files/a.txt", true},
+		{[]string{"files"}, "files/sub/b.txt", true},
+		{[]string{"files"}, "other/files.txt", false},
+		{[]string{"var/www"}, "var/www/index.html", true},
+		{[]string{"a.txt", "b.txt"}, "b.txt", true},
+		{nil, "dump.sql", false},
+	}
+	for _, test := range tests {
+		if got := matchPatterns(test.patterns, test.localName); got != test.want {
+			t.Errorf("matchPatterns(%q, %q) = %v, want %v", test.patterns, test.localName, got, test.want)
+		}
+	}
+}
+
+func TestSourcePatterns(t *testing.T) {
+	tests := []struct {
+		source SourceInfo
+		want   []string
+	}{
+		{SourceInfo{Type: "local", Info: SourceLocalInfo{Paths: []string{"/var/lib/db.sql", "/srv/files/"}}}, []string{"db.sql", "files"}},
+		{SourceInfo{Type: "sftp", Info: map[string]interface{}{"downloads": []string{"/home/user/dump.sql"}}}, []string{"home/user/dump.sql"}},
+		{SourceInfo{Type: "s3", Info: map[string]interface{}{"downloads": []string{"db/dump.sql"}}}, []string{"dump.sql"}},
+		{SourceInfo{Type: "s3", Info: map[string]interface{}{"prefix": "db/"}}, nil},
+		{SourceInfo{Type: "s3", Info: map[string]interface{}{"pattern": "*.sql"}}, nil},
+	}
+	for _, test := range tests {
+		s, err := newSource(test.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := s.(Patterner).Patterns()
+		if strings.Join(got, ",") != strings.Join(test.want, ",") || (got == nil) != (test.want == nil) {
+			t.Errorf("%s %v patterns = %q, want %q", test.source.Type, test.source.Info, got, test.want)
+		}
+	}
+}
@@ -1,17 +1,144 @@
 package backup
 
+import (
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type SourceResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
 type SourceInfo struct {
-	Type string      `json:"type"`
-	Info interface{} `json:"info"`
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Folder string       `json:"folder"`
+	Info   interface{}  `json:"info"`
+	Result SourceResult `json:"-"`
+}
+
+// Source downloads the files of a backup run into tmpDir.
+type Source interface {
+	Fetch(b *Backup, tmpDir string) error
+}
+
+// Patterner is implemented by sources which know the names of the files they
+// fetch, as slash separated path.Match patterns relative to the source folder.
+// A pattern matching a directory matches everything under it.
+type Patterner interface {
+	Patterns() []string
+}
+
+// SourceFactory builds a Source from the raw "info" object of the config.
+type SourceFactory func(info interface{}) (Source, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]SourceFactory)
+)
+
+// RegisterSource makes a source type available to the "type" field of a backup source.
+func RegisterSource(sourceType string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if factory == nil {
+		panic("backup: RegisterSource factory is nil")
+	}
+	if _, dup := sources[sourceType]; dup {
+		panic("backup: RegisterSource called twice for type " + sourceType)
+	}
+	sources[sourceType] = factory
+}
+
+func newSource(source SourceInfo) (Source, error) {
+	sourcesMu.RLock()
+	factory, ok := sources[source.Type]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source type: %q", source.Type)
+	}
+	return factory(source.Info)
+}
+
+// sources returns the single "source" (if set) followed by the "sources" list.
+func (b *Backup) sources() []*SourceInfo {
+	var srcs []*SourceInfo
+	if b.Source.Type != "" {
+		srcs = append(srcs, &b.Source)
+	}
+	for i := range b.Sources {
+		srcs = append(srcs, &b.Sources[i])
+	}
+	return srcs
 }
 
 func (b *Backup) runSource() error {
-	source := b.Source
-	switch source.Type {
-	case "ftp":
-		return b.runSourceFTP()
-	case "sftp":
-		return b.runSourceSFTP()
+	srcs := b.sources()
+	if len(srcs) == 0 {
+		return errors.New("no source")
+	}
+
+	allErr := true
+	for _, src := range srcs {
+		src.Result = SourceResult{}
+		err := b.fetchFrom(src)
+		if err != nil {
+			src.Result.Error = err.Error()
+			logger.Main.Errorw("source error", "name", b.Name, "id", b.ID, "source", src.displayName(), "error", err)
+		} else {
+			src.Result.Success = true
+			allErr = false
+		}
+	}
+	if allErr {
+		return errors.New("all sources failed")
 	}
 	return nil
 }
+
+func (b *Backup) fetchFrom(src *SourceInfo) error {
+	source, err := newSource(*src)
+	if err != nil {
+		return err
+	}
+
+	// Tmp local directory, sources with a folder are put into ./tmp/{id}/{folder}/
+	tmpDir := b.tmpDir()
+	if src.Folder != "" {
+		folder, ok := localRelPath(src.Folder)
+		if !ok {
+			return fmt.Errorf("invalid source folder: %q", src.Folder)
+		}
+		tmpDir = filepath.ToSlash(filepath.Join(tmpDir, folder)) + "/"
+	}
+	err = os.MkdirAll(tmpDir, 0777)
+	if err != nil {
+		logger.Main.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
+		return err
+	}
+
+	return source.Fetch(b, tmpDir)
+}
+
+// localRelPath cleans a slash separated name and converts it to a local path.
+// It returns false if the name is absolute or leaves its parent with "..".
+func localRelPath(name string) (string, bool) {
+	relPath := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(relPath) || strings.HasPrefix(name, "/") || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return relPath, true
+}
+
+func (src *SourceInfo) displayName() string {
+	if src.Name != "" {
+		return src.Name
+	}
+	return src.Type
+}
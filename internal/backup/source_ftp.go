@@ -5,7 +5,8 @@ import (
 	"github.com/xacnio/backupper/internal/utils"
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"github.com/xacnio/backupper/pkg/ftp"
-	"os"
+	"path"
+	"strings"
 )
 
 type SourceFTPInfo struct {
@@ -16,9 +17,18 @@ type SourceFTPInfo struct {
 	Downloads []string `json:"downloads"`
 }
 
-func (b *Backup) runSourceFTP() error {
-	source := b.Source
-	info := utils.ConvertToStruct[SourceFTPInfo](source.Info)
+type sourceFTP struct {
+	info SourceFTPInfo
+}
+
+func init() {
+	RegisterSource("ftp", func(info interface{}) (Source, error) {
+		return &sourceFTP{info: utils.ConvertToStruct[SourceFTPInfo](info)}, nil
+	})
+}
+
+func (s *sourceFTP) Fetch(b *Backup, tmpDir string) error {
+	info := s.info
 
 	if len(info.Downloads) == 0 {
 		return errors.New("empty downloads")
@@ -38,15 +48,7 @@ func (b *Backup) runSourceFTP() error {
 	} else {
 		defer ftpConn.Disconnect()
 
-		logger.SSH.Debugw("connection success", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port)
-
-		// Tmp local directory
-		tmpDir := "./tmp/" + b.stringID() + "/"
-		err = os.MkdirAll(tmpDir, 0777)
-		if err != nil {
-			logger.Main.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
-			return err
-		}
+		logger.FTP.Debugw("connection success", "name", b.Name, "id", b.ID, "host", info.Host, "port", info.Port)
 
 		// Download files
 		allErr := true
@@ -68,3 +70,11 @@ func (b *Backup) runSourceFTP() error {
 	}
 	return nil
 }
+
+func (s *sourceFTP) Patterns() []string {
+	var patterns []string
+	for _, downloadFile := range s.info.Downloads {
+		patterns = append(patterns, strings.TrimPrefix(path.Clean(downloadFile), "/"))
+	}
+	return patterns
+}
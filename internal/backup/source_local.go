@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"github.com/xacnio/backupper/pkg/local"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+)
+
+type SourceLocalInfo struct {
+	Variables      *map[string]interface{} `json:"variables"`
+	BeforeCommands []string                `json:"beforeCommands"`
+	Paths          []string                `json:"paths"`
+	Excludes       []string                `json:"excludes"`
+	AfterCommands  []string                `json:"afterCommands"`
+}
+
+type sourceLocal struct {
+	info SourceLocalInfo
+}
+
+func init() {
+	RegisterSource("local", func(info interface{}) (Source, error) {
+		return &sourceLocal{info: utils.ConvertToStruct[SourceLocalInfo](info)}, nil
+	})
+}
+
+func (s *sourceLocal) Fetch(b *Backup, tmpDir string) error {
+	info := s.info
+
+	if len(info.Paths) == 0 {
+		return errors.New("empty paths")
+	}
+
+	absTmpDir, err := filepath.Abs(tmpDir)
+	if err != nil {
+		return err
+	}
+	env := []string{
+		"BACKUP_ID=" + b.stringID(),
+		"BACKUP_NAME=" + b.Name,
+		"BACKUP_DIR=" + absTmpDir,
+	}
+	if info.Variables != nil {
+		for k, v := range *info.Variables {
+			value := ""
+			switch v.(type) {
+			case string:
+				value = v.(string)
+			case float64:
+				value = strconv.FormatFloat(v.(float64), 'f', -1, 64)
+			case bool:
+				value = strconv.FormatBool(v.(bool))
+			default:
+				continue
+			}
+			env = append(env, k+"="+value)
+		}
+	}
+
+	if len(info.BeforeCommands) > 0 {
+		combinedOutput, err := local.RunCommands(info.BeforeCommands, env)
+		if err != nil {
+			logger.Local.Errorw("before commands error", "name", b.Name, "id", b.ID, "output", combinedOutput, "error", err)
+			return err
+		} else {
+			logger.Local.Debugw("before commands success", "name", b.Name, "id", b.ID, "output", combinedOutput, "commands", info.BeforeCommands)
+		}
+	}
+
+	// Copy files
+	matches, err := s.matches(b)
+	if err != nil {
+		return err
+	}
+	allErr := true
+	for _, match := range matches {
+		localPath := filepath.Join(tmpDir, filepath.Base(match))
+		logger.Local.Debugw("copy start", "name", b.Name, "id", b.ID, "path", match, "localPath", localPath)
+		err = local.CopyTree(match, localPath, func(relPath string, d fs.DirEntry) bool {
+			return s.excluded(relPath)
+		})
+		if err != nil {
+			logger.Local.Errorw("copy error", "name", b.Name, "id", b.ID, "path", match, "error", err)
+			continue
+		} else {
+			allErr = false
+			logger.Local.Debugw("copy success", "name", b.Name, "id", b.ID, "path", match, "localPath", localPath)
+		}
+	}
+	if allErr {
+		return errors.New("all copies failed")
+	}
+
+	if len(info.AfterCommands) > 0 {
+		combinedOutput, err := local.RunCommands(info.AfterCommands, env)
+		if err != nil {
+			logger.Local.Errorw("after commands error", "name", b.Name, "id", b.ID, "output", combinedOutput, "error", err)
+			return err
+		} else {
+			logger.Local.Debugw("after commands success", "name", b.Name, "id", b.ID, "output", combinedOutput, "commands", info.AfterCommands)
+		}
+	}
+	return nil
+}
+
+// matches returns the files and directories matched by the paths which aren't
+// excluded. They are copied by their base name, so two of them can't share one.
+func (s *sourceLocal) matches(b *Backup) ([]string, error) {
+	var result []string
+	names := make(map[string]string)
+	for _, pattern := range s.info.Paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Local.Errorw("glob error", "name", b.Name, "id", b.ID, "pattern", pattern, "error", err)
+			continue
+		}
+		if len(matches) == 0 {
+			logger.Local.Errorw("no files matched", "name", b.Name, "id", b.ID, "pattern", pattern)
+			continue
+		}
+		for _, match := range matches {
+			if s.excluded(match) {
+				logger.Local.Debugw("copy skipped", "name", b.Name, "id", b.ID, "path", match)
+				continue
+			}
+			base := filepath.Base(match)
+			if other, ok := names[base]; ok {
+				// Matched by more than one path
+				if other == match {
+					continue
+				}
+				return nil, fmt.Errorf("%s and %s have the same name %s", other, match, base)
+			}
+			names[base] = match
+			result = append(result, match)
+		}
+	}
+	return result, nil
+}
+
+// excluded reports whether p matches one of the exclude patterns, either by
+// its full path or by its base name.
+func (s *sourceLocal) excluded(p string) bool {
+	for _, pattern := range s.info.Excludes {
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(p)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sourceLocal) Patterns() []string {
+	var patterns []string
+	for _, pattern := range s.info.Paths {
+		patterns = append(patterns, filepath.ToSlash(filepath.Base(pattern)))
+	}
+	return patterns
+}
@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"errors"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type SourceS3Info struct {
+	S3ConnInfo
+	Downloads []string `json:"downloads"`
+	Prefix    string   `json:"prefix"`
+	Pattern   string   `json:"pattern"`
+}
+
+type sourceS3 struct {
+	info SourceS3Info
+}
+
+func init() {
+	RegisterSource("s3", func(info interface{}) (Source, error) {
+		return &sourceS3{info: utils.ConvertToStruct[SourceS3Info](info)}, nil
+	})
+}
+
+func (s *sourceS3) Fetch(b *Backup, tmpDir string) error {
+	info := s.info
+
+	if len(info.Downloads) == 0 && info.Prefix == "" && info.Pattern == "" {
+		return errors.New("empty downloads")
+	}
+
+	conn := info.newConn()
+	err := conn.Connect()
+	if err != nil {
+		logger.S3.Errorw("connection error", "name", b.Name, "id", b.ID, "endpoint", info.Endpoint, "bucket", info.Bucket, "error", err)
+		return err
+	}
+	defer conn.Disconnect()
+
+	logger.S3.Debugw("connection success", "name", b.Name, "id", b.ID, "endpoint", info.Endpoint, "bucket", info.Bucket)
+
+	// Specific keys are saved by their base name, keys found under the prefix keep their relative path
+	downloads := make(map[string]string)
+	for _, key := range info.Downloads {
+		downloads[key] = path.Base(key)
+	}
+	if info.Prefix != "" || info.Pattern != "" {
+		prefix := s3Prefix(info.Prefix)
+		objects, err := conn.List(prefix, true)
+		if err != nil {
+			logger.S3.Errorw("list error", "name", b.Name, "id", b.ID, "endpoint", info.Endpoint, "bucket", info.Bucket, "prefix", prefix, "error", err)
+			return err
+		}
+		for _, object := range objects {
+			relKey := strings.TrimPrefix(object.Key, prefix)
+			if info.Pattern != "" {
+				matchRel, _ := path.Match(info.Pattern, relKey)
+				matchBase, _ := path.Match(info.Pattern, path.Base(relKey))
+				if !matchRel && !matchBase {
+					continue
+				}
+			}
+			downloads[object.Key] = relKey
+		}
+	}
+
+	// Download files
+	allErr := true
+	for key, localName := range downloads {
+		// Keys come from other systems, they must not leave the run directory
+		relPath, ok := localRelPath(localName)
+		if !ok || relPath == "." {
+			logger.S3.Errorw("download error", "name", b.Name, "id", b.ID, "bucket", info.Bucket, "key", key, "error", "invalid key")
+			continue
+		}
+		localPath := filepath.Join(tmpDir, relPath)
+		logger.S3.Debugw("download start", "name", b.Name, "id", b.ID, "bucket", info.Bucket, "key", key, "localPath", localPath)
+
+		err = conn.Download(key, localPath)
+		if err != nil {
+			logger.S3.Errorw("download error", "name", b.Name, "id", b.ID, "bucket", info.Bucket, "key", key, "error", err)
+			continue
+		} else {
+			allErr = false
+			logger.S3.Debugw("download success", "name", b.Name, "id", b.ID, "bucket", info.Bucket, "key", key, "localPath", localPath)
+		}
+	}
+	if allErr {
+		return errors.New("all downloads failed")
+	}
+	return nil
+}
+
+func (s *sourceS3) Patterns() []string {
+	// Keys found under the prefix keep their relative path, which can be
+	// anything, so the files can only be told apart by the manifest
+	if s.info.Prefix != "" || s.info.Pattern != "" {
+		return nil
+	}
+	var patterns []string
+	for _, key := range s.info.Downloads {
+		patterns = append(patterns, path.Base(key))
+	}
+	return patterns
+}
@@ -0,0 +1,38 @@
+package backup
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSourceS3(t *testing.T) {
+	conn, backend := testS3Server(t, "data")
+	conn.Bucket = "data"
+	putTestObject(t, backend, "data", "db/dump.sql", "dump")
+	putTestObject(t, backend, "data", "db/sub/a.txt", "a")
+	putTestObject(t, backend, "data", "db/../../evil.txt", "evil")
+	putTestObject(t, backend, "data", "other/b.txt", "b")
+
+	target := t.TempDir()
+	b := &Backup{
+		Name:        "s3-source",
+		Source:      SourceInfo{Type: "s3", Info: SourceS3Info{S3ConnInfo: conn, Prefix: "db"}},
+		Destination: DestinationInfo{Type: "local", Info: DestinationLocalInfo{Target: target}},
+	}
+	waitNextSecond()
+	b.CreateFunc()()
+	if b.Destination.Result.TotalUploadedFiles != 3 {
+		t.Fatalf("uploaded %d files, want 3", b.Destination.Result.TotalUploadedFiles)
+	}
+
+	// The unsafe key is skipped, the others keep their path under the prefix
+	date := b.getFileTimeFormat()
+	want := []string{"dump-" + date + ".sql", "manifest-" + date + ".json", "sub/a-" + date + ".txt"}
+	if got := readTestDir(t, target); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("uploaded %q, want %q", got, want)
+	}
+	if _, err := os.Stat("evil.txt"); err == nil {
+		t.Error("unsafe key was downloaded outside of the run directory")
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"github.com/xacnio/backupper/pkg/sftp"
 	"github.com/xacnio/backupper/pkg/ssh"
-	"os"
+	"path"
 	"strconv"
 	"strings"
 )
@@ -24,9 +24,18 @@ type SourceSFTPInfo struct {
 	Passphrase     string                  `json:"passphrase"`
 }
 
-func (b *Backup) runSourceSFTP() error {
-	source := b.Source
-	info := utils.ConvertToStruct[SourceSFTPInfo](source.Info)
+type sourceSFTP struct {
+	info SourceSFTPInfo
+}
+
+func init() {
+	RegisterSource("sftp", func(info interface{}) (Source, error) {
+		return &sourceSFTP{info: utils.ConvertToStruct[SourceSFTPInfo](info)}, nil
+	})
+}
+
+func (s *sourceSFTP) Fetch(b *Backup, tmpDir string) error {
+	info := s.info
 
 	sftpConn := sftp.New(sftp.ConnConfig{
 		Host:       info.Host,
@@ -91,14 +100,6 @@ func (b *Backup) runSourceSFTP() error {
 			}
 		}
 
-		// Tmp local directory
-		tmpDir := "./tmp/" + b.stringID() + "/"
-		err = os.MkdirAll(tmpDir, 0777)
-		if err != nil {
-			logger.SSH.Errorw("tmp directory error", "name", b.Name, "id", b.ID, "error", err)
-			return err
-		}
-
 		// SFTP session
 		err = sftpConn.Connect()
 		if err != nil {
@@ -147,3 +148,11 @@ func (b *Backup) runSourceSFTP() error {
 	}
 	return nil
 }
+
+func (s *sourceSFTP) Patterns() []string {
+	var patterns []string
+	for _, downloadFile := range s.info.Downloads {
+		patterns = append(patterns, strings.TrimPrefix(path.Clean(downloadFile), "/"))
+	}
+	return patterns
+}
@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLocalRelPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"dump.sql", "dump.sql", true},
+		{"db/./sub//a.txt", filepath.Join("db", "sub", "a.txt"), true},
+		{"db/../a.txt", "a.txt", true},
+		{"..", "", false},
+		{"../evil.txt", "", false},
+		{"db/../../evil.txt", "", false},
+		{"/etc/passwd", "", false},
+		{"..evil.txt", "..evil.txt", true},
+	}
+	for _, test := range tests {
+		got, ok := localRelPath(test.name)
+		if got != test.want || ok != test.ok {
+			t.Errorf("localRelPath(%q) = %q, %v, want %q, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestSourceLocalFetch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need a POSIX shell")
+	}
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "db.sql"), "dump")
+	writeTestFile(t, filepath.Join(src, "db.log"), "log")
+	writeTestFile(t, filepath.Join(src, "files", "a.txt"), "a")
+	writeTestFile(t, filepath.Join(src, "files", "cache", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(src, "files", "sub", "c.tmp"), "c")
+	writeTestFile(t, filepath.Join(src, "files", "sub", "d.txt"), "d")
+
+	s := &sourceLocal{info: SourceLocalInfo{
+		Variables:      &map[string]interface{}{"GREETING": "hello", "COUNT": 3.0},
+		BeforeCommands: []string{`echo "$GREETING $COUNT $BACKUP_NAME" > "$BACKUP_DIR/before.txt"`},
+		Paths:          []string{filepath.Join(src, "*")},
+		// By the name of a match, by the name of a directory and by the path in a match
+		Excludes:      []string{"*.log", "cache", "sub/*.tmp"},
+		AfterCommands: []string{`files=$(ls "$BACKUP_DIR")`, `echo $files > "$BACKUP_DIR/after.txt"`},
+	}}
+	tmpDir := t.TempDir()
+	err := s.Fetch(&Backup{Name: "db", ID: 1}, tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"after.txt", "before.txt", "db.sql", "files/a.txt", "files/sub/d.txt"}
+	if got := readTestDir(t, tmpDir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("fetched %q, want %q", got, want)
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, "before.txt"))
+	if err != nil || string(data) != "hello 3 db\n" {
+		t.Errorf("before.txt = %q, %v", data, err)
+	}
+	// The after commands run once everything is copied
+	data, err = os.ReadFile(filepath.Join(tmpDir, "after.txt"))
+	if err != nil || string(data) != "before.txt db.sql files\n" {
+		t.Errorf("after.txt = %q, %v", data, err)
+	}
+}
+
+func TestSourceLocalFetchErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need a POSIX shell")
+	}
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "db.sql"), "dump")
+	writeTestFile(t, filepath.Join(src, "db.log"), "log")
+	writeTestFile(t, filepath.Join(src, "a", "config"), "a")
+	writeTestFile(t, filepath.Join(src, "b", "config"), "b")
+
+	tests := []struct {
+		name  string
+		info  SourceLocalInfo
+		err   string
+		files []string
+	}{
+		{
+			name: "before commands failed",
+			info: SourceLocalInfo{BeforeCommands: []string{"exit 3"}, Paths: []string{filepath.Join(src, "db.sql")}},
+			err:  "exit status 3",
+		},
+		{
+			name:  "after commands failed",
+			info:  SourceLocalInfo{Paths: []string{filepath.Join(src, "db.sql")}, AfterCommands: []string{"exit 4"}},
+			err:   "exit status 4",
+			files: []string{"db.sql"},
+		},
+		{
+			name: "same name",
+			info: SourceLocalInfo{Paths: []string{filepath.Join(src, "*", "config")}},
+			err:  "same name config",
+		},
+		{
+			name:  "same match twice",
+			info:  SourceLocalInfo{Paths: []string{filepath.Join(src, "db.sql"), filepath.Join(src, "*.sql")}},
+			files: []string{"db.sql"},
+		},
+		{
+			name: "everything excluded",
+			info: SourceLocalInfo{Paths: []string{filepath.Join(src, "*.log")}, Excludes: []string{"*.log"}},
+			err:  "all copies failed",
+		},
+		{
+			name: "no paths",
+			err:  "empty paths",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			err := (&sourceLocal{info: test.info}).Fetch(&Backup{Name: "db", ID: 1}, tmpDir)
+			if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("error = %v, want %q", err, test.err)
+			}
+			if got := readTestDir(t, tmpDir); strings.Join(got, ",") != strings.Join(test.files, ",") {
+				t.Errorf("fetched %q, want %q", got, test.files)
+			}
+		})
+	}
+}
@@ -7,10 +7,17 @@ import (
 )
 
 type Config struct {
-	DateFormat string        `json:"dateFormat"`
-	LogLevel   *string       `json:"logLevel"`
-	Backups    []interface{} `json:"backups"`
-	Timezone   *string       `json:"timezone"`
+	DateFormat      string        `json:"dateFormat"`
+	LogLevel        *string       `json:"logLevel"`
+	Backups         []interface{} `json:"backups"`
+	Timezone        *string       `json:"timezone"`
+	HistoryFile     *string       `json:"historyFile"`
+	HistoryKeepRuns *int          `json:"historyKeepRuns"`
+	HistoryKeepDays *int          `json:"historyKeepDays"`
+	HTTPListen      *string       `json:"httpListen"`
+	APIToken        *string       `json:"apiToken"`
+	Dashboard       bool          `json:"dashboard"`
+	Notifications   []interface{} `json:"notifications"`
 }
 
 var config *Config
@@ -19,6 +26,11 @@ func Get() *Config {
 	return config
 }
 
+// Set replaces the loaded config, e.g. in tests.
+func Set(c *Config) {
+	config = c
+}
+
 func ReadConfig() Config {
 	f, err := os.Open("config.json")
 	if err != nil {
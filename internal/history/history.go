@@ -0,0 +1,470 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/xacnio/backupper/internal/config"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	KindBackup = "backup"
+	KindPrune  = "prune"
+)
+
+const defaultPath = "history.db"
+
+// defaultKeepRuns is the number of runs kept per job unless "historyKeepRuns" is set.
+const defaultKeepRuns = 1000
+
+var (
+	runsBucket   = []byte("runs")
+	totalsBucket = []byte("totals")
+)
+
+type Stage struct {
+	Name     string        `json:"name"`
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+type Source struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Destination struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Success  bool     `json:"success"`
+	Error    string   `json:"error,omitempty"`
+	Files    int64    `json:"files"`
+	Bytes    int64    `json:"bytes"`
+	Deleted  []string `json:"deleted,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Run is a finished backup (or prune) run of a job.
+type Run struct {
+	Kind         string        `json:"kind"`
+	Job          string        `json:"job"`
+	ID           int64         `json:"id"`
+	StartedAt    time.Time     `json:"startedAt"`
+	FinishedAt   time.Time     `json:"finishedAt"`
+	Success      bool          `json:"success"`
+	Error        string        `json:"error,omitempty"`
+	Stages       []Stage       `json:"stages"`
+	Sources      []Source      `json:"sources"`
+	Destinations []Destination `json:"destinations"`
+	Files        int64         `json:"files"`
+	Bytes        int64         `json:"bytes"`
+	Deleted      int           `json:"deleted"`
+	// Log is an excerpt of the log lines of the run.
+	Log []string `json:"log,omitempty"`
+}
+
+// AddStage records the result of a stage which started at started.
+func (r *Run) AddStage(name string, started time.Time, err error) {
+	stage := Stage{
+		Name:     name,
+		Success:  err == nil,
+		Duration: time.Since(started),
+	}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+	r.Stages = append(r.Stages, stage)
+}
+
+func (r *Run) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Totals are the counters of a job over every recorded run, they are kept
+// when old runs are removed from the history.
+type Totals struct {
+	Job string `json:"job"`
+	// Runs counts the backup runs by status, "success" or "failed".
+	Runs              map[string]int64 `json:"runs"`
+	Files             int64            `json:"files"`
+	Bytes             int64            `json:"bytes"`
+	Deleted           int64            `json:"deleted"`
+	SourceErrors      map[string]int64 `json:"sourceErrors"`
+	DestinationErrors map[string]int64 `json:"destinationErrors"`
+	// LastRun is the start of the last backup run, zero if there is none.
+	LastRun       time.Time     `json:"lastRun"`
+	LastDuration  time.Duration `json:"lastDuration"`
+	LastSuccess   bool          `json:"lastSuccess"`
+	LastSuccessAt time.Time     `json:"lastSuccessAt"`
+}
+
+func NewTotals(job string) *Totals {
+	return &Totals{
+		Job:               job,
+		Runs:              map[string]int64{"success": 0, "failed": 0},
+		SourceErrors:      make(map[string]int64),
+		DestinationErrors: make(map[string]int64),
+	}
+}
+
+// Add counts a run, runs must be added oldest first.
+func (t *Totals) Add(run Run) {
+	t.Deleted += int64(run.Deleted)
+	for _, src := range run.Sources {
+		if src.Error != "" {
+			t.SourceErrors[src.Type]++
+		}
+	}
+	for _, dest := range run.Destinations {
+		if dest.Error != "" {
+			t.DestinationErrors[dest.Type]++
+		}
+	}
+	if run.Kind != KindBackup {
+		return
+	}
+
+	t.LastRun = run.StartedAt
+	t.LastDuration = run.Duration()
+	t.LastSuccess = run.Success
+	t.Files += run.Files
+	t.Bytes += run.Bytes
+	if run.Success {
+		t.LastSuccessAt = run.FinishedAt
+		t.Runs["success"]++
+	} else {
+		t.Runs["failed"]++
+	}
+}
+
+var (
+	mu        sync.Mutex
+	listeners []func(run Run)
+)
+
+// OnRecord registers fn to be called with every recorded run.
+func OnRecord(fn func(run Run)) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Path returns the history database file, "historyFile" of the config or history.db.
+func Path() string {
+	if config.Get() != nil && config.Get().HistoryFile != nil && *config.Get().HistoryFile != "" {
+		return *config.Get().HistoryFile
+	}
+	return defaultPath
+}
+
+// The database is only opened while it is used, so the history command can
+// read it while backups are running.
+func open(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(Path(), 0600, &bolt.Options{
+		Timeout:  10 * time.Second,
+		ReadOnly: readOnly,
+	})
+}
+
+func key(id int64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(id))
+	return k
+}
+
+// Record saves a run, the runs of a job are kept ordered by their ID.
+func Record(run *Run) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	db, err := open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		runs, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		totals, err := tx.CreateBucketIfNotExists(totalsBucket)
+		if err != nil {
+			return err
+		}
+		job, err := runs.CreateBucketIfNotExists([]byte(run.Job))
+		if err != nil {
+			return err
+		}
+
+		// Totals are counted before the run is stored, a missing one is
+		// rebuilt from the runs of a history written by an older version
+		t, err := readTotals(totals, job, run.Job)
+		if err != nil {
+			return err
+		}
+		t.Add(*run)
+		totalsData, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		err = totals.Put([]byte(run.Job), totalsData)
+		if err != nil {
+			return err
+		}
+
+		err = job.Put(key(run.ID), data)
+		if err != nil {
+			return err
+		}
+		return prune(job)
+	})
+	for _, fn := range listeners {
+		fn(*run)
+	}
+	return err
+}
+
+// readTotals returns the stored totals of a job, or counts them from its runs.
+func readTotals(totals *bolt.Bucket, job *bolt.Bucket, name string) (*Totals, error) {
+	t := NewTotals(name)
+	if totals != nil {
+		if data := totals.Get([]byte(name)); data != nil {
+			return t, json.Unmarshal(data, t)
+		}
+	}
+	if job == nil {
+		return t, nil
+	}
+	err := job.ForEach(func(_, v []byte) error {
+		var run Run
+		err := json.Unmarshal(v, &run)
+		if err != nil {
+			return err
+		}
+		t.Add(run)
+		return nil
+	})
+	return t, err
+}
+
+// prune removes the runs of a job older than "historyKeepDays" and all but
+// the newest "historyKeepRuns" (1000 by default, 0 keeps every run).
+func prune(job *bolt.Bucket) error {
+	keepRuns := defaultKeepRuns
+	keepDays := 0
+	if config.Get() != nil {
+		if config.Get().HistoryKeepRuns != nil {
+			keepRuns = *config.Get().HistoryKeepRuns
+		}
+		if config.Get().HistoryKeepDays != nil {
+			keepDays = *config.Get().HistoryKeepDays
+		}
+	}
+
+	var cutoff []byte
+	if keepDays > 0 {
+		cutoff = key(time.Now().AddDate(0, 0, -keepDays).UnixNano())
+	}
+	// Keys are the start times, newest last
+	var remove [][]byte
+	c := job.Cursor()
+	count := 0
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		count++
+		if (keepRuns > 0 && count > keepRuns) || (cutoff != nil && bytes.Compare(k, cutoff) < 0) {
+			remove = append(remove, append([]byte{}, k...))
+		}
+	}
+	for _, k := range remove {
+		err := job.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// view runs fn in a read-only transaction, fn is not called if there is no history yet.
+func view(fn func(runs *bolt.Bucket) error) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := os.Stat(Path()); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	db, err := open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		if runs == nil {
+			return nil
+		}
+		return fn(runs)
+	})
+}
+
+// List returns the runs of a job (of every job if job is empty), newest
+// first. A limit of 0 returns every run.
+func List(job string, limit int) ([]Run, error) {
+	var result []Run
+	err := view(func(runs *bolt.Bucket) error {
+		return runs.ForEach(func(name, _ []byte) error {
+			if job != "" && string(name) != job {
+				return nil
+			}
+			c := runs.Bucket(name).Cursor()
+			count := 0
+			for k, v := c.Last(); k != nil && (limit <= 0 || count < limit); k, v = c.Prev() {
+				var run Run
+				err := json.Unmarshal(v, &run)
+				if err != nil {
+					return err
+				}
+				result = append(result, run)
+				count++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartedAt.After(result[j].StartedAt)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// Last returns the newest run of a job with the given kind, or nil.
+func Last(job string, kind string) (*Run, error) {
+	var last *Run
+	err := view(func(runs *bolt.Bucket) error {
+		bucket := runs.Bucket([]byte(job))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run Run
+			err := json.Unmarshal(v, &run)
+			if err != nil {
+				return err
+			}
+			if run.Kind == kind {
+				last = &run
+				return nil
+			}
+		}
+		return nil
+	})
+	return last, err
+}
+
+// Between returns the runs of a job which started in [from, to), oldest first.
+func Between(job string, from time.Time, to time.Time) ([]Run, error) {
+	var result []Run
+	err := view(func(runs *bolt.Bucket) error {
+		bucket := runs.Bucket([]byte(job))
+		if bucket == nil {
+			return nil
+		}
+		// The keys are the start times of the runs
+		c := bucket.Cursor()
+		end := key(to.UnixNano())
+		for k, v := c.Seek(key(from.UnixNano())); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var run Run
+			err := json.Unmarshal(v, &run)
+			if err != nil {
+				return err
+			}
+			result = append(result, run)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Get returns the run of a job with the given ID, or nil.
+func Get(job string, id int64) (*Run, error) {
+	var run *Run
+	err := view(func(runs *bolt.Bucket) error {
+		bucket := runs.Bucket([]byte(job))
+		if bucket == nil {
+			return nil
+		}
+		v := bucket.Get(key(id))
+		if v == nil {
+			return nil
+		}
+		run = &Run{}
+		return json.Unmarshal(v, run)
+	})
+	return run, err
+}
+
+// AllTotals returns the totals of every job with recorded runs.
+func AllTotals() ([]*Totals, error) {
+	var result []*Totals
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := os.Stat(Path()); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		if runs == nil {
+			return nil
+		}
+		totals := tx.Bucket(totalsBucket)
+		return runs.ForEach(func(name, _ []byte) error {
+			t, err := readTotals(totals, runs.Bucket(name), string(name))
+			if err != nil {
+				return err
+			}
+			result = append(result, t)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Jobs returns the names of the jobs with recorded runs.
+func Jobs() ([]string, error) {
+	var jobs []string
+	err := view(func(runs *bolt.Bucket) error {
+		return runs.ForEach(func(name, _ []byte) error {
+			jobs = append(jobs, string(name))
+			return nil
+		})
+	})
+	return jobs, err
+}
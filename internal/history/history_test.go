@@ -0,0 +1,228 @@
+package history
+
+import (
+	"github.com/xacnio/backupper/internal/config"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testHistory uses a new history file with the given keep settings.
+func testHistory(t *testing.T, keepRuns *int, keepDays *int) {
+	t.Helper()
+	historyFile := filepath.Join(t.TempDir(), "history.db")
+	config.Set(&config.Config{HistoryFile: &historyFile, HistoryKeepRuns: keepRuns, HistoryKeepDays: keepDays})
+	t.Cleanup(func() { config.Set(nil) })
+}
+
+func testRun(job string, started time.Time, success bool) *Run {
+	return &Run{
+		Kind:       KindBackup,
+		Job:        job,
+		ID:         started.UnixNano(),
+		StartedAt:  started,
+		FinishedAt: started.Add(time.Minute),
+		Success:    success,
+		Files:      2,
+		Bytes:      100,
+	}
+}
+
+func record(t *testing.T, runs ...*Run) {
+	t.Helper()
+	for _, run := range runs {
+		err := Record(run)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func ids(runs []Run) []int64 {
+	var result []int64
+	for _, run := range runs {
+		result = append(result, run.ID)
+	}
+	return result
+}
+
+func equalIDs(got []Run, want ...*Run) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].ID != want[i].ID || got[i].Job != want[i].Job {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListOrder(t *testing.T) {
+	testHistory(t, nil, nil)
+	start := time.Now().Add(-time.Hour)
+	db1 := testRun("db", start, true)
+	files1 := testRun("files", start.Add(time.Minute), true)
+	db2 := testRun("db", start.Add(2*time.Minute), false)
+	// Recorded out of order, the runs are ordered by their start
+	record(t, db2, files1, db1)
+
+	runs, err := List("", 0)
+	if err != nil || !equalIDs(runs, db2, files1, db1) {
+		t.Errorf("List = %v, %v", ids(runs), err)
+	}
+	runs, err = List("db", 0)
+	if err != nil || !equalIDs(runs, db2, db1) {
+		t.Errorf("List(db) = %v, %v", ids(runs), err)
+	}
+	runs, err = List("", 2)
+	if err != nil || !equalIDs(runs, db2, files1) {
+		t.Errorf("List limit 2 = %v, %v", ids(runs), err)
+	}
+
+	last, err := Last("db", KindBackup)
+	if err != nil || last == nil || last.ID != db2.ID {
+		t.Errorf("Last = %+v, %v", last, err)
+	}
+	last, err = Last("db", KindPrune)
+	if err != nil || last != nil {
+		t.Errorf("Last prune = %+v, %v", last, err)
+	}
+	run, err := Get("files", files1.ID)
+	if err != nil || run == nil || run.StartedAt.Unix() != files1.StartedAt.Unix() {
+		t.Errorf("Get = %+v, %v", run, err)
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	testHistory(t, nil, nil)
+	runs, err := List("", 0)
+	if err != nil || len(runs) != 0 {
+		t.Errorf("List = %v, %v", ids(runs), err)
+	}
+	totals, err := AllTotals()
+	if err != nil || len(totals) != 0 {
+		t.Errorf("AllTotals = %+v, %v", totals, err)
+	}
+}
+
+func TestKeepRuns(t *testing.T) {
+	keepRuns := 2
+	testHistory(t, &keepRuns, nil)
+	start := time.Now().Add(-time.Hour)
+	var all []*Run
+	for i := 0; i < 4; i++ {
+		all = append(all, testRun("db", start.Add(time.Duration(i)*time.Minute), true))
+	}
+	other := testRun("files", start, true)
+	record(t, other)
+	record(t, all...)
+
+	runs, err := List("db", 0)
+	if err != nil || !equalIDs(runs, all[3], all[2]) {
+		t.Errorf("List(db) = %v, %v", ids(runs), err)
+	}
+	// The limit is per job
+	runs, err = List("files", 0)
+	if err != nil || !equalIDs(runs, other) {
+		t.Errorf("List(files) = %v, %v", ids(runs), err)
+	}
+
+	// The totals still count the removed runs
+	totals, err := AllTotals()
+	if err != nil || len(totals) != 2 {
+		t.Fatalf("AllTotals = %+v, %v", totals, err)
+	}
+	if totals[0].Job != "db" || totals[0].Runs["success"] != 4 || totals[0].Files != 8 {
+		t.Errorf("totals = %+v", totals[0])
+	}
+}
+
+func TestKeepDays(t *testing.T) {
+	keepRuns := 0
+	keepDays := 7
+	testHistory(t, &keepRuns, &keepDays)
+	now := time.Now()
+	old := testRun("db", now.AddDate(0, 0, -30), true)
+	recent := testRun("db", now.AddDate(0, 0, -1), true)
+	record(t, old, recent)
+
+	runs, err := List("db", 0)
+	if err != nil || !equalIDs(runs, recent) {
+		t.Errorf("List = %v, %v", ids(runs), err)
+	}
+}
+
+func TestTotalsRebuilt(t *testing.T) {
+	testHistory(t, nil, nil)
+	start := time.Now().Add(-time.Hour)
+	prune := testRun("db", start.Add(time.Minute), true)
+	prune.Kind = KindPrune
+	prune.Deleted = 3
+	prune.Destinations = []Destination{{Name: "s3", Type: "s3", Error: "access denied"}}
+	failed := testRun("db", start.Add(2*time.Minute), false)
+	record(t, testRun("db", start, true), prune, failed)
+
+	want, err := AllTotals()
+	if err != nil || len(want) != 1 {
+		t.Fatalf("AllTotals = %+v, %v", want, err)
+	}
+
+	// A history written by an older version has no totals
+	db, err := open(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(totalsBucket)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := AllTotals()
+	if err != nil || len(totals) != 1 {
+		t.Fatalf("AllTotals = %+v, %v", totals, err)
+	}
+	got := totals[0]
+	if got.Runs["success"] != 1 || got.Runs["failed"] != 1 || got.Files != 4 || got.Deleted != 3 || got.DestinationErrors["s3"] != 1 {
+		t.Errorf("rebuilt totals = %+v", got)
+	}
+	if got.LastSuccess || !got.LastRun.Equal(want[0].LastRun) || !got.LastSuccessAt.Equal(want[0].LastSuccessAt) {
+		t.Errorf("rebuilt totals = %+v, want %+v", got, want[0])
+	}
+
+	// The next run continues from the rebuilt totals
+	record(t, testRun("db", start.Add(3*time.Minute), true))
+	totals, err = AllTotals()
+	if err != nil || len(totals) != 1 || totals[0].Runs["success"] != 2 || totals[0].Runs["failed"] != 1 {
+		t.Errorf("AllTotals = %+v, %v", totals, err)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	testHistory(t, nil, nil)
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	var all []*Run
+	for i := 0; i < 4; i++ {
+		all = append(all, testRun("db", start.Add(time.Duration(i)*time.Minute), true))
+	}
+	record(t, all...)
+	record(t, testRun("files", start.Add(time.Minute), true))
+
+	// from is included, to is not, oldest first
+	runs, err := Between("db", all[1].StartedAt, all[3].StartedAt)
+	if err != nil || !equalIDs(runs, all[1], all[2]) {
+		t.Errorf("Between = %v, %v", ids(runs), err)
+	}
+	runs, err = Between("db", start.Add(-time.Hour), start)
+	if err != nil || len(runs) != 0 {
+		t.Errorf("Between before the first run = %v, %v", ids(runs), err)
+	}
+	runs, err = Between("cache", start, start.Add(time.Hour))
+	if err != nil || len(runs) != 0 {
+		t.Errorf("Between of an unknown job = %v, %v", ids(runs), err)
+	}
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/xacnio/backupper/internal/history"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	mu   sync.Mutex
+	jobs = make(map[string]*history.Totals)
+)
+
+// Init loads the totals of the run history and keeps them up to date with
+// every recorded run. Jobs without runs are exported with zero counters.
+func Init(jobNames []string) error {
+	totals, err := history.AllTotals()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	for _, job := range jobNames {
+		jobs[job] = history.NewTotals(job)
+	}
+	for _, t := range totals {
+		jobs[t.Job] = t
+	}
+	mu.Unlock()
+
+	history.OnRecord(func(run history.Run) {
+		mu.Lock()
+		defer mu.Unlock()
+		t, ok := jobs[run.Job]
+		if !ok {
+			t = history.NewTotals(run.Job)
+			jobs[run.Job] = t
+		}
+		t.Add(run)
+	})
+	return nil
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		write(w)
+	})
+}
+
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value func(t *history.Totals) map[string]float64
+}
+
+// single returns the value of a metric without extra labels, ok is false if it isn't known yet.
+func single(value func(t *history.Totals) (float64, bool)) func(t *history.Totals) map[string]float64 {
+	return func(t *history.Totals) map[string]float64 {
+		v, ok := value(t)
+		if !ok {
+			return nil
+		}
+		return map[string]float64{"": v}
+	}
+}
+
+func unix(t time.Time) float64 {
+	return float64(t.Unix())
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var metricList = []metric{
+	{"backupper_last_success_timestamp_seconds", "Unix time of the last successful backup run.", "gauge",
+		single(func(t *history.Totals) (float64, bool) { return unix(t.LastSuccessAt), !t.LastSuccessAt.IsZero() })},
+	{"backupper_last_run_timestamp_seconds", "Unix time of the start of the last backup run.", "gauge",
+		single(func(t *history.Totals) (float64, bool) { return unix(t.LastRun), !t.LastRun.IsZero() })},
+	{"backupper_last_run_duration_seconds", "Duration of the last backup run.", "gauge",
+		single(func(t *history.Totals) (float64, bool) { return t.LastDuration.Seconds(), !t.LastRun.IsZero() })},
+	{"backupper_last_run_success", "Whether the last backup run succeeded (1) or failed (0).", "gauge",
+		single(func(t *history.Totals) (float64, bool) { return boolValue(t.LastSuccess), !t.LastRun.IsZero() })},
+	{"backupper_runs_total", "Backup runs by status.", "counter",
+		func(t *history.Totals) map[string]float64 { return labeled("status", t.Runs) }},
+	{"backupper_uploaded_bytes_total", "Bytes uploaded to all destinations.", "counter",
+		single(func(t *history.Totals) (float64, bool) { return float64(t.Bytes), true })},
+	{"backupper_uploaded_files_total", "Files uploaded to all destinations.", "counter",
+		single(func(t *history.Totals) (float64, bool) { return float64(t.Files), true })},
+	{"backupper_retention_deleted_files_total", "Files deleted by retention rules.", "counter",
+		single(func(t *history.Totals) (float64, bool) { return float64(t.Deleted), true })},
+	{"backupper_source_errors_total", "Failed sources by source type.", "counter",
+		func(t *history.Totals) map[string]float64 { return labeled("type", t.SourceErrors) }},
+	{"backupper_destination_errors_total", "Failed destinations by destination type.", "counter",
+		func(t *history.Totals) map[string]float64 { return labeled("type", t.DestinationErrors) }},
+}
+
+func labeled(label string, values map[string]int64) map[string]float64 {
+	result := make(map[string]float64)
+	for k, v := range values {
+		result[label+`="`+escape(k)+`"`] = float64(v)
+	}
+	return result
+}
+
+func write(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var names []string
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, m := range metricList {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, name := range names {
+			values := m.value(jobs[name])
+			var labels []string
+			for l := range values {
+				labels = append(labels, l)
+			}
+			sort.Strings(labels)
+			for _, l := range labels {
+				extra := ""
+				if l != "" {
+					extra = "," + l
+				}
+				fmt.Fprintf(w, "%s{name=\"%s\"%s} %s\n", m.name, escape(name), extra, strconv.FormatFloat(values[l], 'f', -1, 64))
+			}
+		}
+	}
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"github.com/xacnio/backupper/internal/history"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testJobs replaces the exported jobs until the end of the test.
+func testJobs(t *testing.T, totals ...*history.Totals) {
+	t.Helper()
+	mu.Lock()
+	saved := jobs
+	jobs = make(map[string]*history.Totals)
+	for _, total := range totals {
+		jobs[total.Job] = total
+	}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		jobs = saved
+		mu.Unlock()
+	})
+}
+
+// checkGolden compares the metrics with testdata/<name>.golden, -update rewrites it.
+func checkGolden(t *testing.T, name string) {
+	t.Helper()
+	var buf bytes.Buffer
+	write(&buf)
+
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.WriteFile(golden, buf.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("metrics differ from %s:\n%s", golden, buf.String())
+	}
+}
+
+func TestWriteNoRuns(t *testing.T) {
+	testJobs(t, history.NewTotals("db"))
+	checkGolden(t, "no_runs")
+}
+
+func TestWriteRuns(t *testing.T) {
+	start := time.Date(2023, 7, 20, 10, 30, 0, 0, time.UTC)
+	db := history.NewTotals("db")
+	db.Add(history.Run{
+		Kind:         history.KindBackup,
+		StartedAt:    start,
+		FinishedAt:   start.Add(90 * time.Second),
+		Success:      true,
+		Files:        3,
+		Bytes:        2048,
+		Deleted:      2,
+		Destinations: []history.Destination{{Type: "local"}},
+	})
+	db.Add(history.Run{
+		Kind:       history.KindPrune,
+		StartedAt:  start.Add(time.Hour),
+		FinishedAt: start.Add(time.Hour + time.Second),
+		Success:    false,
+		Deleted:    1,
+		Destinations: []history.Destination{
+			{Type: "s3", Error: "access denied"},
+		},
+	})
+	db.Add(history.Run{
+		Kind:       history.KindBackup,
+		StartedAt:  start.Add(2 * time.Hour),
+		FinishedAt: start.Add(2*time.Hour + 500*time.Millisecond),
+		Success:    false,
+		Sources:    []history.Source{{Type: "mysql", Error: "connection refused"}},
+	})
+	testJobs(t, db, history.NewTotals("files"))
+	checkGolden(t, "runs")
+}
+
+func TestWriteEscape(t *testing.T) {
+	total := history.NewTotals("db \"main\"\\prod\n")
+	total.SourceErrors[`my"sql\`] = 1
+	testJobs(t, total)
+	checkGolden(t, "escape")
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultRunsLimit = 50
+
+type jobStatus struct {
+	Name           string       `json:"name"`
+	CronExpression string       `json:"cronExpr"`
+	NextRun        *time.Time   `json:"nextRun"`
+	Running        bool         `json:"running"`
+	Paused         bool         `json:"paused"`
+	LastRun        *history.Run `json:"lastRun"`
+}
+
+type api struct {
+	token   string
+	backups []*backup.Backup
+}
+
+func (a *api) authorized(r *http.Request) bool {
+	return hasBearer(r, a.token)
+}
+
+// hasBearer reports whether r sends "Authorization: Bearer <token>".
+func hasBearer(r *http.Request, token string) bool {
+	value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && equalToken(value, token)
+}
+
+func equalToken(value string, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+}
+
+func findBackup(backups []*backup.Backup, name string) *backup.Backup {
+	for _, b := range backups {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// jobStatusOf returns the schedule state of a job with its last backup run.
+func jobStatusOf(b *backup.Backup) (jobStatus, error) {
+	status := jobStatus{
+		Name:           b.Name,
+		CronExpression: b.CronExpression,
+		Running:        b.IsRunning(),
+		Paused:         b.IsPaused(),
+	}
+	if b.Job != nil {
+		nextRun := b.Job.NextRun()
+		status.NextRun = &nextRun
+	}
+	lastRun, err := history.Last(b.Name, history.KindBackup)
+	status.LastRun = lastRun
+	return status, err
+}
+
+// ServeHTTP routes /jobs, /jobs/{name}/runs and /jobs/{name}/{run|pause|resume}.
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		jobs := []jobStatus{}
+		for _, b := range a.backups {
+			status, err := jobStatusOf(b)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			jobs = append(jobs, status)
+		}
+		writeJSON(w, http.StatusOK, jobs)
+		return
+	}
+
+	b := findBackup(a.backups, parts[1])
+	if b == nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		status, err := jobStatusOf(b)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+	if len(parts) != 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	action := parts[2]
+	if action == "runs" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		limit := defaultRunsLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				writeError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+			limit = parsed
+		}
+		runs, err := history.List(b.Name, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if runs == nil {
+			runs = []history.Run{}
+		}
+		writeJSON(w, http.StatusOK, runs)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	switch action {
+	case "run":
+		if !b.Start() {
+			writeError(w, http.StatusConflict, "job is already running")
+			return
+		}
+		logger.Main.Infow("backup triggered by api", "name", b.Name)
+	case "pause":
+		b.Pause()
+		logger.Main.Infow("backup paused by api", "name", b.Name)
+	case "resume":
+		b.Resume()
+		logger.Main.Infow("backup resumed by api", "name", b.Name)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	status, err := jobStatusOf(b)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
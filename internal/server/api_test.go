@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/history"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+// request serves a request with the Authorization header, if set.
+func request(t *testing.T, h http.Handler, method string, target string, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(w.Body.Bytes(), v)
+	if err != nil {
+		t.Fatalf("%s: %v", w.Body.String(), err)
+	}
+}
+
+func TestAPIUnauthorized(t *testing.T) {
+	a := &api{token: testToken, backups: []*backup.Backup{{Name: "db"}}}
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"no token", ""},
+		{"wrong token", "Bearer wrong"},
+		{"token without scheme", testToken},
+		{"other scheme", "Basic " + testToken},
+		{"empty bearer", "Bearer "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := request(t, a, http.MethodGet, "/jobs", test.authorization)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", w.Code)
+			}
+		})
+	}
+
+	w := request(t, a, http.MethodGet, "/jobs", "Bearer "+testToken)
+	if w.Code != http.StatusOK {
+		t.Errorf("status with the token = %d, want 200", w.Code)
+	}
+}
+
+func TestAPIRunConflict(t *testing.T) {
+	b := &backup.Backup{Name: "blocked", Source: backup.SourceInfo{Type: "block"}}
+	a := &api{token: testToken, backups: []*backup.Backup{b}}
+	bearer := "Bearer " + testToken
+
+	w := request(t, a, http.MethodPost, "/jobs/blocked/run", bearer)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	var status jobStatus
+	decode(t, w, &status)
+	if !status.Running {
+		t.Error("job isn't running")
+	}
+
+	w = request(t, a, http.MethodPost, "/jobs/blocked/run", bearer)
+	if w.Code != http.StatusConflict {
+		t.Errorf("second run status = %d, want 409", w.Code)
+	}
+
+	testRelease <- struct{}{}
+	for i := 0; b.IsRunning(); i++ {
+		if i == 100 {
+			t.Fatal("job didn't finish")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	w = request(t, a, http.MethodPost, "/jobs/blocked/run", bearer)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("run after the first finished = %d, want 202", w.Code)
+	}
+	testRelease <- struct{}{}
+	for b.IsRunning() {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestAPIPauseResume(t *testing.T) {
+	a := &api{token: testToken, backups: []*backup.Backup{{Name: "db"}}}
+	bearer := "Bearer " + testToken
+
+	tests := []struct {
+		method string
+		target string
+		code   int
+		paused bool
+	}{
+		{http.MethodPost, "/jobs/db/pause", http.StatusAccepted, true},
+		{http.MethodGet, "/jobs/db", http.StatusOK, true},
+		{http.MethodPost, "/jobs/db/pause", http.StatusAccepted, true},
+		{http.MethodPost, "/jobs/db/resume", http.StatusAccepted, false},
+		{http.MethodGet, "/jobs/db", http.StatusOK, false},
+	}
+	for _, test := range tests {
+		w := request(t, a, test.method, test.target, bearer)
+		if w.Code != test.code {
+			t.Fatalf("%s %s status = %d, want %d", test.method, test.target, w.Code, test.code)
+		}
+		var status jobStatus
+		decode(t, w, &status)
+		if status.Name != "db" || status.Paused != test.paused {
+			t.Errorf("%s %s = %+v, want paused %v", test.method, test.target, status, test.paused)
+		}
+	}
+
+	for _, test := range []struct {
+		method string
+		target string
+		code   int
+	}{
+		{http.MethodGet, "/jobs/db/pause", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/jobs/db/stop", http.StatusNotFound},
+		{http.MethodPost, "/jobs/cache/pause", http.StatusNotFound},
+		{http.MethodPost, "/jobs", http.StatusMethodNotAllowed},
+	} {
+		w := request(t, a, test.method, test.target, bearer)
+		if w.Code != test.code {
+			t.Errorf("%s %s status = %d, want %d", test.method, test.target, w.Code, test.code)
+		}
+	}
+}
+
+func TestAPIRunsLimit(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		started := start.Add(time.Duration(i) * time.Minute)
+		err := history.Record(&history.Run{Kind: history.KindBackup, Job: "limited", ID: started.UnixNano(), StartedAt: started, Success: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := &api{token: testToken, backups: []*backup.Backup{{Name: "limited"}, {Name: "empty"}}}
+	bearer := "Bearer " + testToken
+
+	tests := []struct {
+		target string
+		code   int
+		runs   int
+	}{
+		{"/jobs/limited/runs", http.StatusOK, 3},
+		{"/jobs/limited/runs?limit=2", http.StatusOK, 2},
+		{"/jobs/limited/runs?limit=0", http.StatusOK, 3},
+		{"/jobs/limited/runs?limit=-1", http.StatusBadRequest, 0},
+		{"/jobs/limited/runs?limit=ten", http.StatusBadRequest, 0},
+		{"/jobs/empty/runs", http.StatusOK, 0},
+	}
+	for _, test := range tests {
+		w := request(t, a, http.MethodGet, test.target, bearer)
+		if w.Code != test.code {
+			t.Errorf("%s status = %d, want %d", test.target, w.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			if !strings.Contains(w.Body.String(), "invalid limit") {
+				t.Errorf("%s body = %s", test.target, w.Body.String())
+			}
+			continue
+		}
+		var runs []history.Run
+		decode(t, w, &runs)
+		if runs == nil || len(runs) != test.runs {
+			t.Errorf("%s returned %d runs, want %d", test.target, len(runs), test.runs)
+		}
+	}
+}
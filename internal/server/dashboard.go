@@ -0,0 +1,147 @@
+package server
+
+import (
+	"embed"
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/history"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed web
+var webFS embed.FS
+
+const dashboardRuns = 50
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"size": utils.FormatSize,
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.In(utils.TimeLocation).Format("2006-01-02 15:04:05")
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+}).ParseFS(webFS, "web/*.html"))
+
+type dashboard struct {
+	// token is required if set, as bearer token or as the password of basic auth.
+	token   string
+	backups []*backup.Backup
+}
+
+type jobsPage struct {
+	Jobs []jobStatus
+}
+
+type runsPage struct {
+	Job  jobStatus
+	Runs []history.Run
+}
+
+type runPage struct {
+	Job string
+	Run *history.Run
+}
+
+func (d *dashboard) handler() http.Handler {
+	static, _ := fs.Sub(webFS, "web/static")
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("/", d.serveJobs)
+	mux.HandleFunc("/job/", d.serveJob)
+	if d.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="backupper"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized accepts the API token, browsers send it as the password of basic auth.
+func (d *dashboard) authorized(r *http.Request) bool {
+	if hasBearer(r, d.token) {
+		return true
+	}
+	_, password, ok := r.BasicAuth()
+	return ok && equalToken(password, d.token)
+}
+
+func (d *dashboard) serveJobs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	var page jobsPage
+	for _, b := range d.backups {
+		status, err := jobStatusOf(b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.Jobs = append(page.Jobs, status)
+	}
+	d.render(w, "jobs.html", page)
+}
+
+// serveJob serves /job/{name} with the last runs and /job/{name}/{id} with a single run.
+func (d *dashboard) serveJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/job/"), "/"), "/")
+	b := findBackup(d.backups, parts[0])
+	if b == nil || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 {
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		run, err := history.Get(b.Name, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if run == nil {
+			http.NotFound(w, r)
+			return
+		}
+		d.render(w, "run.html", runPage{Job: b.Name, Run: run})
+		return
+	}
+
+	status, err := jobStatusOf(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	runs, err := history.List(b.Name, dashboardRuns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.render(w, "runs.html", runsPage{Job: status, Runs: runs})
+}
+
+func (d *dashboard) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := templates.ExecuteTemplate(w, name, data)
+	if err != nil {
+		logger.Main.Errorw("dashboard error", "page", name, "error", err)
+	}
+}
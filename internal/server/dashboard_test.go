@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/history"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboardToken(t *testing.T) {
+	backups := []*backup.Backup{{Name: "db"}}
+
+	w := request(t, (&dashboard{backups: backups}).handler(), http.MethodGet, "/", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("status without a token = %d, want 200", w.Code)
+	}
+
+	h := (&dashboard{token: testToken, backups: backups}).handler()
+	tests := []struct {
+		name   string
+		target string
+		setup  func(r *http.Request)
+		code   int
+	}{
+		{"no token", "/", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"no token job", "/job/db", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong password", "/", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized},
+		{"wrong bearer", "/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{"basic auth", "/", func(r *http.Request) { r.SetBasicAuth("admin", testToken) }, http.StatusOK},
+		{"bearer", "/job/db", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testToken) }, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.target, nil)
+			test.setup(r)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Errorf("status = %d, want %d", w.Code, test.code)
+			}
+			if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+				t.Errorf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestDashboardJob(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+	run := &history.Run{Kind: history.KindBackup, Job: "web", ID: started.UnixNano(), StartedAt: started, FinishedAt: started.Add(time.Second), Success: true, Log: []string{"backup finished"}}
+	err := history.Record(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := (&dashboard{backups: []*backup.Backup{{Name: "web"}}}).handler()
+	id := strconv.FormatInt(run.ID, 10)
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/job/web", http.StatusOK, "/job/web/" + id},
+		{"/job/web/", http.StatusOK, "/job/web/" + id},
+		{"/job/web/" + id, http.StatusOK, "backup finished"},
+		{"/job/cache", http.StatusNotFound, ""},
+		{"/job/", http.StatusNotFound, ""},
+		{"/job/web/latest", http.StatusNotFound, ""},
+		{"/job/web/1", http.StatusNotFound, ""},
+		{"/job/web/" + id + "/log", http.StatusNotFound, ""},
+		{"/jobs", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := request(t, h, http.MethodGet, test.target, "")
+		if w.Code != test.code {
+			t.Errorf("%s status = %d, want %d", test.target, w.Code, test.code)
+			continue
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s doesn't contain %q", test.target, test.body)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/config"
+	"github.com/xacnio/backupper/internal/utils"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRelease lets the running fetch of a "block" source return.
+var testRelease = make(chan struct{})
+
+type blockSource struct{}
+
+func (blockSource) Fetch(b *backup.Backup, tmpDir string) error {
+	<-testRelease
+	return os.WriteFile(filepath.Join(tmpDir, "dump.sql"), []byte("dump"), 0600)
+}
+
+// TestMain keeps the history of the tests in a temporary directory.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "backupper-test-*")
+	if err != nil {
+		panic(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	historyFile := filepath.Join(dir, "history.db")
+	config.Set(&config.Config{DateFormat: "2006-01-02__15-04-05", HistoryFile: &historyFile})
+	utils.TimeLocation = time.UTC
+	nop := zap.NewNop().Sugar()
+	logger.Main, logger.SSH, logger.SFTP, logger.FTP, logger.TgBot, logger.Local, logger.S3 = nop, nop, nop, nop, nop, nop, nop
+	backup.RegisterSource("block", func(info interface{}) (backup.Source, error) {
+		return blockSource{}, nil
+	})
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"github.com/xacnio/backupper/internal/backup"
+	"github.com/xacnio/backupper/internal/metrics"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"net/http"
+	"time"
+)
+
+type Options struct {
+	Listen string
+	// Token enables the jobs API, requests must send "Authorization: Bearer <token>".
+	Token string
+	// Dashboard enables the read-only web UI on "/", it requires the token if one is set.
+	Dashboard bool
+	Backups   []*backup.Backup
+}
+
+// Start serves the HTTP endpoints in the background.
+func Start(opts Options) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	if opts.Token != "" {
+		jobs := &api{token: opts.Token, backups: opts.Backups}
+		mux.Handle("/jobs", jobs)
+		mux.Handle("/jobs/", jobs)
+	}
+	if opts.Dashboard {
+		mux.Handle("/", (&dashboard{token: opts.Token, backups: opts.Backups}).handler())
+	}
+
+	srv := &http.Server{
+		Addr:              opts.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.Main.Infow("http server started", "listen", opts.Listen, "api", opts.Token != "", "dashboard", opts.Dashboard)
+		err := srv.ListenAndServe()
+		if err != nil {
+			logger.Main.Errorw("http server error", "listen", opts.Listen, "error", err)
+		}
+	}()
+}
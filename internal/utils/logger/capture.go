@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"sync"
+)
+
+// maxCaptureLines is the number of log lines kept per run, older lines are dropped.
+const maxCaptureLines = 200
+
+var (
+	capturesMu sync.Mutex
+	captures   = make(map[int64][]string)
+)
+
+// StartCapture starts keeping the log lines with the given "id" field.
+func StartCapture(id int64) {
+	capturesMu.Lock()
+	defer capturesMu.Unlock()
+	captures[id] = []string{}
+}
+
+// StopCapture stops keeping the log lines of id and returns them.
+func StopCapture(id int64) []string {
+	capturesMu.Lock()
+	defer capturesMu.Unlock()
+	lines := captures[id]
+	delete(captures, id)
+	return lines
+}
+
+// captureCore writes the entries of captured runs to their line lists, it is
+// teed with the file output of every logger.
+type captureCore struct {
+	zapcore.LevelEnabler
+	name   string
+	enc    zapcore.Encoder
+	fields []zapcore.Field
+}
+
+func newCaptureCore(name string, enabler zapcore.LevelEnabler) zapcore.Core {
+	encoderConfig := zapcore.EncoderConfig{
+		TimeKey:        "ts",
+		LevelKey:       "level",
+		NameKey:        "logger",
+		MessageKey:     "msg",
+		EncodeTime:     zapcore.TimeEncoderOfLayout("15:04:05.000"),
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+	return &captureCore{
+		LevelEnabler: enabler,
+		name:         name,
+		enc:          zapcore.NewConsoleEncoder(encoderConfig),
+	}
+}
+
+func (c *captureCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field{}, c.fields...), fields...)
+	return &clone
+}
+
+func (c *captureCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *captureCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	fields = append(append([]zapcore.Field{}, c.fields...), fields...)
+	id, ok := captureID(fields)
+	if !ok {
+		return nil
+	}
+
+	capturesMu.Lock()
+	defer capturesMu.Unlock()
+	lines, ok := captures[id]
+	if !ok {
+		return nil
+	}
+
+	// The name and id are the same for every line of a run
+	var rest []zapcore.Field
+	for _, field := range fields {
+		if field.Key != "id" && field.Key != "name" {
+			rest = append(rest, field)
+		}
+	}
+	entry.LoggerName = c.name
+	buf, err := c.enc.EncodeEntry(entry, rest)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, strings.TrimSuffix(buf.String(), "\n"))
+	buf.Free()
+	if len(lines) > maxCaptureLines {
+		lines = lines[len(lines)-maxCaptureLines:]
+	}
+	captures[id] = lines
+	return nil
+}
+
+func (c *captureCore) Sync() error {
+	return nil
+}
+
+func captureID(fields []zapcore.Field) (int64, bool) {
+	for _, field := range fields {
+		if field.Key == "id" && field.Type == zapcore.Int64Type {
+			return field.Integer, true
+		}
+	}
+	return 0, false
+}
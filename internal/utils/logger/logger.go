@@ -21,14 +21,22 @@ var (
 	SFTP  *zap.SugaredLogger
 	FTP   *zap.SugaredLogger
 	TgBot *zap.SugaredLogger
+	Local *zap.SugaredLogger
+	S3    *zap.SugaredLogger
 )
 
+// Console is where the Main logger writes besides its file. The sub commands
+// use stderr, so their output on stdout can be parsed.
+var Console = "stdout"
+
 var Logs = []LogConfig{
 	{Output: "main.log", Name: "Main"},
 	{Output: "ssh.log", Name: "SSH"},
 	{Output: "sftp.log", Name: "SFTP"},
 	{Output: "ftp.log", Name: "FTP"},
 	{Output: "tgbot.log", Name: "TgBot"},
+	{Output: "local.log", Name: "Local"},
+	{Output: "s3.log", Name: "S3"},
 }
 
 func loggerConfigBuilder(lc LogConfig) zap.Config {
@@ -37,7 +45,7 @@ func loggerConfigBuilder(lc LogConfig) zap.Config {
 		"logs/" + lc.Output,
 	}
 	if lc.Name == "Main" {
-		zapConfig.OutputPaths = append(zapConfig.OutputPaths, "stdout")
+		zapConfig.OutputPaths = append(zapConfig.OutputPaths, Console)
 	}
 	zapConfig.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout("Jan 02 15:04:05.000000000")
 	logLevel := "info"
@@ -71,7 +79,10 @@ func Init() {
 	}
 
 	for _, log := range Logs {
-		_logger, err := loggerConfigBuilder(log).Build()
+		name := log.Name
+		_logger, err := loggerConfigBuilder(log).Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, newCaptureCore(name, core))
+		}))
 		if err != nil {
 			panic(err)
 		}
@@ -87,6 +98,10 @@ func Init() {
 			FTP = _sugar
 		case "TgBot":
 			TgBot = _sugar
+		case "Local":
+			Local = _sugar
+		case "S3":
+			S3 = _sugar
 		}
 	}
 }
@@ -0,0 +1,297 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FormatTarGz  = "tar.gz"
+	FormatTarZst = "tar.zst"
+	FormatTarXz  = "tar.xz"
+	FormatZip    = "zip"
+)
+
+// Extension returns the file extension (with the leading dot) of an archive format.
+func Extension(format string) string {
+	return "." + format
+}
+
+func IsSupported(format string) bool {
+	switch format {
+	case FormatTarGz, FormatTarZst, FormatTarXz, FormatZip:
+		return true
+	}
+	return false
+}
+
+// Create packs every file under srcDir into a new archive at dstPath.
+// Paths inside the archive are relative to srcDir.
+func Create(format string, srcDir string, dstPath string) error {
+	if !IsSupported(format) {
+		return fmt.Errorf("unsupported archive format: %q", format)
+	}
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatZip {
+		err = writeZip(out, srcDir)
+	} else {
+		err = writeTar(out, format, srcDir)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func writeZip(out io.Writer, srcDir string) error {
+	zw := zip.NewWriter(out)
+	err := walk(srcDir, func(p string, name string, info fs.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return copyFile(w, p)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeTar(out io.Writer, format string, srcDir string) error {
+	var cw io.WriteCloser
+	var err error
+	switch format {
+	case FormatTarGz:
+		cw = gzip.NewWriter(out)
+	case FormatTarZst:
+		cw, err = zstd.NewWriter(out)
+	case FormatTarXz:
+		cw, err = xz.NewWriter(out)
+	}
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+	err = walk(srcDir, func(p string, name string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return copyFile(tw, p)
+	})
+	if err != nil {
+		cw.Close()
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// walk calls fn for every directory and regular file under srcDir with its
+// slash separated path relative to srcDir.
+func walk(srcDir string, fn func(p string, name string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		if relPath == "." || (!d.IsDir() && !d.Type().IsRegular()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(p, strings.TrimPrefix(filepath.ToSlash(relPath), "./"), info)
+	})
+}
+
+func copyFile(w io.Writer, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// FormatOf returns the archive format of a file name, or an empty string.
+func FormatOf(name string) string {
+	lower := strings.ToLower(name)
+	for _, format := range []string{FormatTarGz, FormatTarZst, FormatTarXz, FormatZip} {
+		if strings.HasSuffix(lower, Extension(format)) {
+			return format
+		}
+	}
+	return ""
+}
+
+// Extract unpacks the archive at srcPath into dstDir. Entries pointing outside
+// of dstDir are rejected.
+func Extract(format string, srcPath string, dstDir string) error {
+	if !IsSupported(format) {
+		return fmt.Errorf("unsupported archive format: %q", format)
+	}
+	if format == FormatZip {
+		return extractZip(srcPath, dstDir)
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader
+	switch format {
+	case FormatTarGz:
+		gr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case FormatTarZst:
+		zr, err := zstd.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case FormatTarXz:
+		r, err = xz.NewReader(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := extractPath(dstDir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0777)
+		case tar.TypeReg:
+			err = writeFile(target, tr, header.FileInfo().Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(srcPath string, dstDir string) error {
+	zr, err := zip.OpenReader(srcPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		target, err := extractPath(dstDir, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			err = os.MkdirAll(target, 0777)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, file.Mode().Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractPath(dstDir string, name string) (string, error) {
+	target := filepath.Join(dstDir, filepath.FromSlash(name))
+	relPath, err := filepath.Rel(dstDir, target)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in archive: %q", name)
+	}
+	return target, nil
+}
+
+func writeFile(target string, r io.Reader, perm fs.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0777)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readTestArchive returns the files of an archive by their name.
+func readTestArchive(t *testing.T, format string, archivePath string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	if format == FormatZip {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, file := range zr.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[file.Name] = string(data)
+		}
+		return files
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader
+	switch format {
+	case FormatTarGz:
+		r, err = gzip.NewReader(f)
+	case FormatTarZst:
+		r, err = zstd.NewReader(f)
+	case FormatTarXz:
+		r, err = xz.NewReader(f)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(data)
+	}
+}
+
+var testFiles = map[string]string{"db.sql": "dump", "files/a.txt": "a", "files/sub/b.txt": "b"}
+
+func writeTestFiles(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	for name, data := range testFiles {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func TestCreate(t *testing.T) {
+	src := writeTestFiles(t)
+	for _, format := range []string{FormatTarGz, FormatTarZst, FormatTarXz, FormatZip} {
+		t.Run(format, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "backup"+Extension(format))
+			if err := Create(format, src, archivePath); err != nil {
+				t.Fatal(err)
+			}
+			got := readTestArchive(t, format, archivePath)
+			if len(got) != len(testFiles) {
+				t.Errorf("archive has %v, want %v", got, testFiles)
+			}
+			for name, want := range testFiles {
+				if got[name] != want {
+					t.Errorf("%s = %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+
+	if err := Create("rar", src, filepath.Join(t.TempDir(), "backup.rar")); err == nil {
+		t.Error("unsupported format didn't fail")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	src := writeTestFiles(t)
+	for _, format := range []string{FormatTarGz, FormatTarZst, FormatTarXz, FormatZip} {
+		t.Run(format, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "backup"+Extension(format))
+			if err := Create(format, src, archivePath); err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatOf(strings.ToUpper(archivePath)); got != format {
+				t.Errorf("FormatOf = %q, want %q", got, format)
+			}
+			dst := t.TempDir()
+			if err := Extract(format, archivePath, dst); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range testFiles {
+				data, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+				if err != nil || string(data) != want {
+					t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractRejectsTraversal(t *testing.T) {
+	names := []string{"../evil.txt", "a/../../evil.txt", "/../evil.txt"}
+	for _, name := range names {
+		t.Run("tar.gz "+name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "evil.tar.gz")
+			f, err := os.Create(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gw := gzip.NewWriter(f)
+			tw := tar.NewWriter(gw)
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+			tw.Write([]byte("evil"))
+			tw.Close()
+			gw.Close()
+			f.Close()
+			testExtractRejected(t, FormatTarGz, archivePath)
+		})
+		t.Run("zip "+name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "evil.zip")
+			f, err := os.Create(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zw := zip.NewWriter(f)
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte("evil"))
+			zw.Close()
+			f.Close()
+			testExtractRejected(t, FormatZip, archivePath)
+		})
+	}
+}
+
+func testExtractRejected(t *testing.T, format string, archivePath string) {
+	t.Helper()
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "dst")
+	err := Extract(format, archivePath, dst)
+	if err == nil || !strings.Contains(err.Error(), "invalid path in archive") {
+		t.Fatalf("Extract error = %v, want invalid path", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil.txt")); err == nil {
+		t.Fatal("file was written outside of the destination")
+	}
+}
@@ -0,0 +1,215 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FormatAge = "age"
+	FormatGPG = "gpg"
+)
+
+// Extension returns the file extension (with the leading dot) of an encryption format.
+func Extension(format string) string {
+	return "." + format
+}
+
+func IsSupported(format string) bool {
+	return format == FormatAge || format == FormatGPG
+}
+
+// Encrypter encrypts files for a set of public keys, no private key is needed.
+type Encrypter struct {
+	Format        string
+	ageRecipients []age.Recipient
+	pgpEntities   openpgp.EntityList
+}
+
+// NewEncrypter parses the recipients for the format. For age, recipients are
+// X25519 public keys ("age1...") and recipient files contain one key per line.
+// For gpg, recipients are armored public key blocks and recipient files are
+// armored or binary public keyrings.
+func NewEncrypter(format string, recipients []string, recipientFiles []string) (*Encrypter, error) {
+	e := &Encrypter{Format: format}
+	switch format {
+	case FormatAge:
+		for _, r := range recipients {
+			recipient, err := age.ParseX25519Recipient(strings.TrimSpace(r))
+			if err != nil {
+				return nil, err
+			}
+			e.ageRecipients = append(e.ageRecipients, recipient)
+		}
+		for _, file := range recipientFiles {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := age.ParseRecipients(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			e.ageRecipients = append(e.ageRecipients, parsed...)
+		}
+		if len(e.ageRecipients) == 0 {
+			return nil, errors.New("no age recipients")
+		}
+	case FormatGPG:
+		for _, r := range recipients {
+			entities, err := readKeyRing([]byte(r))
+			if err != nil {
+				return nil, err
+			}
+			e.pgpEntities = append(e.pgpEntities, entities...)
+		}
+		for _, file := range recipientFiles {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			entities, err := readKeyRing(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			e.pgpEntities = append(e.pgpEntities, entities...)
+		}
+		if len(e.pgpEntities) == 0 {
+			return nil, errors.New("no gpg public keys")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryption format: %q", format)
+	}
+	return e, nil
+}
+
+// EncryptFile writes the encrypted content of srcPath to dstPath.
+func (e *Encrypter) EncryptFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+
+	var w io.WriteCloser
+	if e.Format == FormatAge {
+		w, err = age.Encrypt(dst, e.ageRecipients...)
+	} else {
+		w, err = openpgp.Encrypt(dst, e.pgpEntities, nil, &openpgp.FileHints{
+			IsBinary: true,
+			FileName: filepath.Base(srcPath),
+		}, nil)
+	}
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	_, err = io.Copy(w, src)
+	if err != nil {
+		w.Close()
+		dst.Close()
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Decrypter decrypts files with private keys, it is only needed for restores.
+type Decrypter struct {
+	Format        string
+	ageIdentities []age.Identity
+	pgpEntities   openpgp.EntityList
+}
+
+// NewDecrypter reads the private keys of the format from identityFile. For age
+// it is an identity file ("AGE-SECRET-KEY-..."), for gpg an armored or binary
+// secret keyring which is unlocked with passphrase if it is protected.
+func NewDecrypter(format string, identityFile string, passphrase string) (*Decrypter, error) {
+	d := &Decrypter{Format: format}
+	data, err := os.ReadFile(identityFile)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatAge:
+		d.ageIdentities, err = age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+	case FormatGPG:
+		d.pgpEntities, err = readKeyRing(data)
+		if err != nil {
+			return nil, err
+		}
+		if passphrase != "" {
+			for _, entity := range d.pgpEntities {
+				err = entity.DecryptPrivateKeys([]byte(passphrase))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryption format: %q", format)
+	}
+	return d, nil
+}
+
+// DecryptFile writes the decrypted content of srcPath to dstPath.
+func (d *Decrypter) DecryptFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var r io.Reader
+	if d.Format == FormatAge {
+		r, err = age.Decrypt(src, d.ageIdentities...)
+		if err != nil {
+			return err
+		}
+	} else {
+		md, err := openpgp.ReadMessage(src, d.pgpEntities, nil, nil)
+		if err != nil {
+			return err
+		}
+		r = md.UnverifiedBody
+	}
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func readKeyRing(data []byte) (openpgp.EntityList, error) {
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
@@ -0,0 +1,189 @@
+package crypt
+
+import (
+	"bytes"
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testAgeKey returns the public key of a new age identity and the path of its identity file.
+func testAgeKey(t *testing.T) (string, string) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	err = os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity.Recipient().String(), identityFile
+}
+
+// testGPGKey returns the armored public key of a new OpenPGP entity and the path
+// of its armored secret keyring, which is protected if passphrase is set.
+func testGPGKey(t *testing.T, passphrase string) (string, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("backupper", "", "backupper@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var public bytes.Buffer
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entity.Serialize(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	var private bytes.Buffer
+	w, err = armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passphrase != "" {
+		err = entity.EncryptPrivateKeys([]byte(passphrase), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = entity.SerializePrivateWithoutSigning(w, nil)
+	} else {
+		err = entity.SerializePrivate(w, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	identityFile := filepath.Join(t.TempDir(), "key.asc")
+	err = os.WriteFile(identityFile, private.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public.String(), identityFile
+}
+
+// roundTrip encrypts data for the recipients and decrypts it with the identity file.
+func roundTrip(t *testing.T, format string, recipients []string, recipientFiles []string, identityFile string, passphrase string) ([]byte, error) {
+	t.Helper()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "dump.sql")
+	err := os.WriteFile(src, []byte("dump"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEncrypter(format, recipients, recipientFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := src + Extension(format)
+	err = e.EncryptFile(src, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(encrypted)
+	if err != nil || bytes.Contains(data, []byte("dump")) {
+		t.Fatalf("encrypted file = %q, %v", data, err)
+	}
+
+	d, err := NewDecrypter(format, identityFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := filepath.Join(dir, "decrypted.sql")
+	err = d.DecryptFile(encrypted, decrypted)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(decrypted)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ageKey, ageIdentity := testAgeKey(t)
+	ageKeyFile := filepath.Join(t.TempDir(), "recipients.txt")
+	err := os.WriteFile(ageKeyFile, []byte("# backup key\n"+ageKey+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpgKey, gpgIdentity := testGPGKey(t, "")
+	gpgProtectedKey, gpgProtectedIdentity := testGPGKey(t, "secret")
+	gpgKeyFile := filepath.Join(t.TempDir(), "public.asc")
+	err = os.WriteFile(gpgKeyFile, []byte(gpgKey), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		format         string
+		recipients     []string
+		recipientFiles []string
+		identity       string
+		passphrase     string
+	}{
+		{"age", FormatAge, []string{ageKey}, nil, ageIdentity, ""},
+		{"age recipient file", FormatAge, nil, []string{ageKeyFile}, ageIdentity, ""},
+		{"gpg", FormatGPG, []string{gpgKey}, nil, gpgIdentity, ""},
+		{"gpg recipient file", FormatGPG, nil, []string{gpgKeyFile}, gpgIdentity, ""},
+		{"gpg passphrase", FormatGPG, []string{gpgProtectedKey}, nil, gpgProtectedIdentity, "secret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := roundTrip(t, test.format, test.recipients, test.recipientFiles, test.identity, test.passphrase)
+			if err != nil || string(data) != "dump" {
+				t.Errorf("decrypted = %q, %v, want dump", data, err)
+			}
+		})
+	}
+}
+
+func TestWrongIdentity(t *testing.T) {
+	ageKey, _ := testAgeKey(t)
+	_, otherAgeIdentity := testAgeKey(t)
+	_, err := roundTrip(t, FormatAge, []string{ageKey}, nil, otherAgeIdentity, "")
+	if err == nil {
+		t.Error("age decryption with another identity didn't fail")
+	}
+
+	gpgKey, _ := testGPGKey(t, "")
+	_, otherGPGIdentity := testGPGKey(t, "")
+	_, err = roundTrip(t, FormatGPG, []string{gpgKey}, nil, otherGPGIdentity, "")
+	if err == nil {
+		t.Error("gpg decryption with another key didn't fail")
+	}
+
+	gpgProtectedKey, gpgProtectedIdentity := testGPGKey(t, "secret")
+	_, err = roundTrip(t, FormatGPG, []string{gpgProtectedKey}, nil, gpgProtectedIdentity, "wrong")
+	if err == nil {
+		t.Error("gpg key with a wrong passphrase didn't fail")
+	}
+}
+
+func TestNewEncrypter(t *testing.T) {
+	tests := []struct {
+		format     string
+		recipients []string
+	}{
+		{FormatAge, nil},
+		{FormatAge, []string{"age1invalid"}},
+		{FormatGPG, nil},
+		{FormatGPG, []string{"not a key"}},
+		{"zip", []string{"age1invalid"}},
+	}
+	for _, test := range tests {
+		_, err := NewEncrypter(test.format, test.recipients, nil)
+		if err == nil {
+			t.Errorf("NewEncrypter(%q, %q) didn't fail", test.format, test.recipients)
+		}
+	}
+}
@@ -1,17 +1,26 @@
 package ftp
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/jlaffaye/ftp"
 	"github.com/xacnio/backupper/internal/utils"
 	"github.com/xacnio/backupper/internal/utils/logger"
 	"io"
+	"net"
+	"net/textproto"
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"time"
 )
 
+// ErrNotSupported is returned if the server doesn't implement a command.
+var ErrNotSupported = errors.New("command not supported by the server")
+
 type FTP struct {
 	Connected bool
 	*ftp.ServerConn
@@ -68,18 +77,30 @@ func (f *FTP) Download(remotePath string, localPath string) error {
 	if err != nil {
 		return err
 	}
-	defer res.Close()
 
 	outFile, err := os.Create(localPath)
 	if err != nil {
+		res.Close()
 		return err
 	}
 	defer outFile.Close()
 
-	_, err = io.Copy(outFile, res)
+	n, err := io.Copy(outFile, res)
+	if err != nil {
+		res.Close()
+		return err
+	}
+	// The transfer must be finished before the next command
+	err = res.Close()
 	if err != nil {
 		return err
 	}
+
+	// Detect truncated transfers if the server supports SIZE
+	size, err := f.ServerConn.FileSize(remotePath)
+	if err == nil && size != n {
+		return fmt.Errorf("size mismatch: downloaded %d bytes, remote file has %d bytes", n, size)
+	}
 	return nil
 }
 
@@ -174,3 +195,100 @@ func (f *FTP) LimitByDate(remoteFolder string, beforeDurationPattern string) ([]
 	}
 	return deleteFiles, nil
 }
+
+// SHA256 reads the remote file back and returns its hex encoded SHA-256.
+func (f *FTP) SHA256(remotePath string) (string, error) {
+	res, err := f.ServerConn.Retr(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer res.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, res)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// RemoteSize returns the size of a remote file with the SIZE command.
+func (f *FTP) RemoteSize(remotePath string) (int64, error) {
+	size, err := f.ServerConn.FileSize(remotePath)
+	return size, notSupported(err)
+}
+
+// HashSHA256 asks the server for the SHA-256 of a remote file with the HASH
+// command (draft-bryan-ftpext-hash), the file isn't transferred. The client
+// library has no raw commands, so it uses a second control connection.
+// A relative remotePath is resolved against the login directory.
+func (f *FTP) HashSHA256(remotePath string) (string, error) {
+	netConn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", f.Host, f.Port), 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	conn := textproto.NewConn(netConn)
+	defer conn.Close()
+
+	_, _, err = conn.ReadResponse(ftp.StatusReady)
+	if err != nil {
+		return "", err
+	}
+	code, _, err := cmd(conn, 0, "USER %s", f.User)
+	if err != nil {
+		return "", err
+	}
+	if code == ftp.StatusUserOK {
+		_, _, err = cmd(conn, ftp.StatusLoggedIn, "PASS %s", f.Pass)
+		if err != nil {
+			return "", err
+		}
+	} else if code != ftp.StatusLoggedIn {
+		return "", fmt.Errorf("unexpected login reply: %d", code)
+	}
+	defer cmd(conn, ftp.StatusClosing, "QUIT")
+
+	_, _, err = cmd(conn, ftp.StatusCommandOK, "OPTS HASH SHA-256")
+	if err != nil {
+		return "", notSupported(err)
+	}
+	// 213 SHA-256 0-49 <hex hash> <file name>
+	_, msg, err := cmd(conn, ftp.StatusFile, "HASH %s", remotePath)
+	if err != nil {
+		return "", notSupported(err)
+	}
+	fields := strings.Fields(msg)
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "SHA-256") {
+		return "", fmt.Errorf("invalid HASH reply: %q", msg)
+	}
+	return strings.ToLower(fields[2]), nil
+}
+
+// cmd sends a command on a control connection, an expectCode of 0 accepts
+// every positive reply.
+func cmd(conn *textproto.Conn, expectCode int, format string, args ...interface{}) (int, string, error) {
+	_, err := conn.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	if expectCode == 0 {
+		code, msg, err := conn.ReadResponse(0)
+		if err == nil && code >= 400 {
+			err = &textproto.Error{Code: code, Msg: msg}
+		}
+		return code, msg, err
+	}
+	return conn.ReadResponse(expectCode)
+}
+
+// notSupported wraps the errors of unknown or unimplemented commands with ErrNotSupported.
+func notSupported(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch protoErr.Code {
+		case ftp.StatusBadCommand, ftp.StatusBadArguments, ftp.StatusNotImplemented, ftp.StatusNotImplementedParameter:
+			return fmt.Errorf("%w: %v", ErrNotSupported, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package ftp
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// testServer accepts a single control connection and answers every command
+// with the reply for its name, unknown commands aren't implemented.
+func testServer(t *testing.T, replies map[string]string) *FTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn := textproto.NewConn(c)
+		defer conn.Close()
+		conn.PrintfLine("220 ready")
+		for {
+			line, err := conn.ReadLine()
+			if err != nil {
+				return
+			}
+			command, _, _ := strings.Cut(line, " ")
+			reply, ok := replies[command]
+			if !ok {
+				reply = "502 not implemented"
+			}
+			conn.PrintfLine("%s", reply)
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return New(ConnConfig{Host: "127.0.0.1", Port: addr.Port, User: "user", Pass: "pass"})
+}
+
+func TestHashSHA256(t *testing.T) {
+	f := testServer(t, map[string]string{
+		"USER": "331 password required",
+		"PASS": "230 logged in",
+		"OPTS": "200 SHA-256",
+		"HASH": "213 SHA-256 0-3 B6CA0868BCA6A2926B70AA1A71592038D9030FE26D4214EDCFBD6CF41F2F4654 dump.sql",
+		"QUIT": "221 bye",
+	})
+	hash, err := f.HashSHA256("dump.sql")
+	if err != nil || hash != "b6ca0868bca6a2926b70aa1a71592038d9030fe26d4214edcfbd6cf41f2f4654" {
+		t.Errorf("hash = %q, %v", hash, err)
+	}
+}
+
+func TestHashSHA256NotSupported(t *testing.T) {
+	f := testServer(t, map[string]string{
+		"USER": "230 logged in",
+		"QUIT": "221 bye",
+	})
+	_, err := f.HashSHA256("dump.sql")
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("error = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestHashSHA256LoginFailed(t *testing.T) {
+	f := testServer(t, map[string]string{
+		"USER": "331 password required",
+		"PASS": "530 login incorrect",
+	})
+	_, err := f.HashSHA256("dump.sql")
+	if err == nil || errors.Is(err, ErrNotSupported) {
+		t.Errorf("error = %v, want a login error", err)
+	}
+}
@@ -0,0 +1,93 @@
+package local
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+func CopyFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dstPath), 0777)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, srcInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// CopyTree copies srcPath (a file or a directory) to dstPath. Entries for
+// which skip returns true are not copied; skipped directories are not entered.
+func CopyTree(srcPath string, dstPath string, skip func(relPath string, d fs.DirEntry) bool) error {
+	return filepath.WalkDir(srcPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcPath, p)
+		if err != nil {
+			return err
+		}
+		if relPath != "." && skip != nil && skip(relPath, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dstPath, relPath)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return CopyFile(p, target)
+	})
+}
+
+// RunCommands runs the commands in a single shell so that variables and the
+// working directory carry over from one command to the next, like ssh.RunCommands.
+func RunCommands(commands []string, env []string) (string, error) {
+	if len(commands) == 0 {
+		return "", nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", strings.Join(commands, " && "))
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", strings.Join(commands, "\n"))
+	}
+	cmd.Env = append(os.Environ(), env...)
+
+	var bf bytes.Buffer
+	cmd.Stdout = &bf
+	cmd.Stderr = &bf
+
+	err := cmd.Run()
+	return bf.String(), err
+}
@@ -0,0 +1,150 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/xacnio/backupper/internal/utils/logger"
+	"io"
+	"sort"
+	"strings"
+)
+
+type S3 struct {
+	Connected bool
+	Client    *minio.Client
+	Config    ConnConfig
+}
+
+type ConnConfig struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	UseSSL       bool
+	PathStyle    bool
+}
+
+func New(c ConnConfig) *S3 {
+	// Accept endpoints given as URLs, the scheme decides whether TLS is used
+	if strings.HasPrefix(c.Endpoint, "http://") {
+		c.Endpoint = strings.TrimPrefix(c.Endpoint, "http://")
+		c.UseSSL = false
+	} else if strings.HasPrefix(c.Endpoint, "https://") {
+		c.Endpoint = strings.TrimPrefix(c.Endpoint, "https://")
+		c.UseSSL = true
+	}
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	if c.Endpoint == "" {
+		c.Endpoint = "s3.amazonaws.com"
+	}
+	return &S3{
+		Config: c,
+	}
+}
+
+func (s *S3) Disconnect() error {
+	s.Connected = false
+	logger.S3.Debugw("disconnected", "endpoint", s.Config.Endpoint, "bucket", s.Config.Bucket)
+	return nil
+}
+
+func (s *S3) Connect() error {
+	var err error
+
+	c := s.Config
+
+	bucketLookup := minio.BucketLookupAuto
+	if c.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+	s.Client, err = minio.New(c.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(c.AccessKey, c.SecretKey, c.SessionToken),
+		Secure:       c.UseSSL,
+		Region:       c.Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.Client.BucketExists(context.Background(), c.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %q does not exist", c.Bucket)
+	}
+
+	s.Connected = true
+	logger.S3.Debugw("connected", "endpoint", c.Endpoint, "bucket", c.Bucket)
+	return nil
+}
+
+// Upload uploads a local file, files bigger than partSize are sent with a multipart upload.
+// A partSize of 0 lets the client pick the part size.
+func (s *S3) Upload(key string, localPath string, storageClass string, partSize uint64) (minio.UploadInfo, error) {
+	return s.Client.FPutObject(context.Background(), s.Config.Bucket, key, localPath, minio.PutObjectOptions{
+		StorageClass: storageClass,
+		PartSize:     partSize,
+	})
+}
+
+func (s *S3) Download(key string, localPath string) error {
+	return s.Client.FGetObject(context.Background(), s.Config.Bucket, key, localPath, minio.GetObjectOptions{})
+}
+
+// List returns the objects under prefix, oldest first. Unless recursive is set
+// only the objects directly under prefix are returned (like the files of a folder).
+func (s *S3) List(prefix string, recursive bool) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for object := range s.Client.ListObjects(context.Background(), s.Config.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: recursive,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].LastModified.Before(objects[j].LastModified)
+	})
+	return objects, nil
+}
+
+func (s *S3) Delete(key string) error {
+	return s.Client.RemoveObject(context.Background(), s.Config.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) FileSize(key string) (int64, error) {
+	info, err := s.Client.StatObject(context.Background(), s.Config.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// SHA256 reads the object back and returns its hex encoded SHA-256.
+func (s *S3) SHA256(key string) (string, error) {
+	object, err := s.Client.GetObject(context.Background(), s.Config.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, object)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
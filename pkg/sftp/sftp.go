@@ -1,6 +1,8 @@
 package sftp
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/sftp"
 	"github.com/xacnio/backupper/internal/utils"
@@ -9,6 +11,7 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -117,10 +120,16 @@ func (f *SFTP) DownloadFile(remotePath string, localPath string) error {
 	}
 	defer localFile.Close()
 
-	_, err = remoteFile.WriteTo(localFile)
+	n, err := remoteFile.WriteTo(localFile)
 	if err != nil {
 		return err
 	}
+
+	// Detect truncated transfers
+	remoteInfo, err := remoteFile.Stat()
+	if err == nil && remoteInfo.Size() != n {
+		return fmt.Errorf("size mismatch: downloaded %d bytes, remote file has %d bytes", n, remoteInfo.Size())
+	}
 	return nil
 }
 
@@ -216,3 +225,40 @@ func (f *SFTP) LimitByDate(remoteFolder string, beforeDurationPattern string) ([
 	}
 	return deletedFiles, nil
 }
+
+func (f *SFTP) FileSize(remotePath string) (int64, error) {
+	info, err := f.Client.Stat(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// SHA256 returns the hex encoded SHA-256 of a remote file. It runs sha256sum
+// on the server if a shell is available, otherwise the file is read back.
+func (f *SFTP) SHA256(remotePath string) (string, error) {
+	session, err := f.SSHClient.NewSession()
+	if err == nil {
+		output, err := session.Output("sha256sum -- '" + strings.ReplaceAll(remotePath, "'", `'\''`) + "'")
+		session.Close()
+		if err == nil {
+			fields := strings.Fields(string(output))
+			if len(fields) > 0 && len(fields[0]) == sha256.Size*2 {
+				return fields[0], nil
+			}
+		}
+	}
+
+	remoteFile, err := f.Client.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer remoteFile.Close()
+
+	h := sha256.New()
+	_, err = remoteFile.WriteTo(h)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}